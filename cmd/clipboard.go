@@ -0,0 +1,220 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/atotto/clipboard"
+)
+
+// clipboardBackend is one way of putting content on a clipboard. available
+// tells whether auto-detection picks it; a backend named with
+// --clipboard-backend is used either way.
+type clipboardBackend struct {
+	name      string
+	available func() bool
+	copy      func(content string) error
+}
+
+// clipboardBackends lists every backend in auto-detection order
+var clipboardBackends = []clipboardBackend{
+	{
+		name:      "pbcopy",
+		available: func() bool { return hasCommand("pbcopy") },
+		copy:      func(content string) error { return pipeTo(content, "pbcopy") },
+	},
+	{
+		name:      "wl-copy",
+		available: func() bool { return os.Getenv("WAYLAND_DISPLAY") != "" && hasCommand("wl-copy") },
+		copy:      func(content string) error { return pipeTo(content, "wl-copy") },
+	},
+	{
+		name:      "xclip",
+		available: func() bool { return os.Getenv("DISPLAY") != "" && hasCommand("xclip") },
+		copy:      func(content string) error { return pipeTo(content, "xclip", "-selection", "clipboard") },
+	},
+	{
+		name:      "xsel",
+		available: func() bool { return os.Getenv("DISPLAY") != "" && hasCommand("xsel") },
+		copy:      func(content string) error { return pipeTo(content, "xsel", "--clipboard", "--input") },
+	},
+	{
+		name:      "system",
+		available: func() bool { return runtime.GOOS == "windows" },
+		copy:      clipboard.WriteAll,
+	},
+	{
+		name:      "tmux",
+		available: func() bool { return os.Getenv("TMUX") != "" && hasCommand("tmux") },
+		copy:      func(content string) error { return pipeTo(content, "tmux", "load-buffer", "-") },
+	},
+	{
+		name:      "osc52",
+		available: func() bool { return (isSSHSession() || inMultiplexer()) && hasTerminal() },
+		copy:      copyOSC52,
+	},
+}
+
+// clipboardBackendNames returns the names accepted by --clipboard-backend
+func clipboardBackendNames() []string {
+	names := []string{"auto"}
+	for _, backend := range clipboardBackends {
+		names = append(names, backend.name)
+	}
+	return names
+}
+
+// selectClipboardBackends returns the backends to try, in order, for the given name
+func selectClipboardBackends(name string) ([]clipboardBackend, error) {
+	if name == "" || name == "auto" {
+		return detectClipboardBackends(), nil
+	}
+	for _, backend := range clipboardBackends {
+		if backend.name == name {
+			return []clipboardBackend{backend}, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown clipboard backend %q (expected one of: %s)", name, strings.Join(clipboardBackendNames(), ", "))
+}
+
+// detectClipboardBackends returns the available backends in auto-detection
+// order. Over SSH the local clipboard is only reachable through the terminal,
+// so OSC 52 is tried before the tmux buffer.
+func detectClipboardBackends() []clipboardBackend {
+	ordered := clipboardBackends
+	if isSSHSession() {
+		ordered = make([]clipboardBackend, 0, len(clipboardBackends))
+		var tmux []clipboardBackend
+		for _, backend := range clipboardBackends {
+			switch backend.name {
+			case "tmux":
+				tmux = append(tmux, backend)
+			case "osc52":
+				ordered = append(ordered, backend)
+				ordered = append(ordered, tmux...)
+			default:
+				ordered = append(ordered, backend)
+			}
+		}
+	}
+
+	var available []clipboardBackend
+	for _, backend := range ordered {
+		if backend.available() {
+			available = append(available, backend)
+		}
+	}
+	return available
+}
+
+// copyToClipboard tries each backend in turn and returns the name of the one that worked
+func copyToClipboard(content string, backends []clipboardBackend) (string, error) {
+	if len(backends) == 0 {
+		return "", errors.New("no clipboard backend available")
+	}
+
+	var failures []string
+	for _, backend := range backends {
+		err := backend.copy(content)
+		if err == nil {
+			return backend.name, nil
+		}
+		failures = append(failures, fmt.Sprintf("%s: %v", backend.name, err))
+	}
+	return "", errors.New(strings.Join(failures, "; "))
+}
+
+// saveToTempFile keeps content that couldn't reach the clipboard
+func saveToTempFile(content string) (string, error) {
+	file, err := os.CreateTemp("", "scopy-*.txt")
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	if _, err := file.WriteString(content); err != nil {
+		return "", err
+	}
+	return file.Name(), nil
+}
+
+// isSSHSession reports whether scopy runs inside an SSH session
+func isSSHSession() bool {
+	return os.Getenv("SSH_TTY") != "" || os.Getenv("SSH_CONNECTION") != ""
+}
+
+// inMultiplexer reports whether scopy runs inside tmux or screen, which
+// pass OSC 52 on to the terminal they run in
+func inMultiplexer() bool {
+	return os.Getenv("TMUX") != "" || os.Getenv("STY") != "" || strings.HasPrefix(os.Getenv("TERM"), "screen")
+}
+
+// hasCommand reports whether name is found in PATH
+func hasCommand(name string) bool {
+	_, err := exec.LookPath(name)
+	return err == nil
+}
+
+// pipeTo runs a command with content on its standard input
+func pipeTo(content string, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = strings.NewReader(content)
+	var stderr strings.Builder
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return fmt.Errorf("%v: %s", err, msg)
+		}
+		return err
+	}
+	return nil
+}
+
+// openTerminal returns the controlling terminal, or nil when there's none
+func openTerminal() *os.File {
+	if tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0); err == nil {
+		return tty
+	}
+	if isTerminal(os.Stderr) {
+		return os.Stderr
+	}
+	return nil
+}
+
+// hasTerminal reports whether a terminal is available for OSC 52
+func hasTerminal() bool {
+	tty := openTerminal()
+	if tty != nil && tty != os.Stderr {
+		tty.Close()
+	}
+	return tty != nil
+}
+
+// copyOSC52 asks the terminal emulator to set the clipboard with an OSC 52
+// escape sequence, which also works through SSH. Inside tmux and screen the
+// sequence is wrapped so it reaches the outer terminal.
+func copyOSC52(content string) error {
+	tty := openTerminal()
+	if tty == nil {
+		return errors.New("no terminal available")
+	}
+	if tty != os.Stderr {
+		defer tty.Close()
+	}
+
+	seq := "\x1b]52;c;" + base64.StdEncoding.EncodeToString([]byte(content)) + "\x07"
+	switch {
+	case os.Getenv("TMUX") != "":
+		seq = "\x1bPtmux;" + strings.ReplaceAll(seq, "\x1b", "\x1b\x1b") + "\x1b\\"
+	case strings.HasPrefix(os.Getenv("TERM"), "screen"):
+		seq = "\x1bP" + seq + "\x1b\\"
+	}
+
+	_, err := tty.WriteString(seq)
+	return err
+}
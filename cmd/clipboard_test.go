@@ -0,0 +1,44 @@
+package cmd
+
+import "testing"
+
+func TestOSC52Detection(t *testing.T) {
+	tests := []struct {
+		name string
+		env  map[string]string
+		want bool
+	}{
+		{"local terminal", map[string]string{"TERM": "xterm-256color"}, false},
+		{"ssh tty", map[string]string{"SSH_TTY": "/dev/pts/1"}, true},
+		{"ssh connection", map[string]string{"SSH_CONNECTION": "10.0.0.1 5000 10.0.0.2 22"}, true},
+		{"tmux", map[string]string{"TMUX": "/tmp/tmux-1000/default,1,0"}, true},
+		{"screen session", map[string]string{"STY": "1234.pts-0.host"}, true},
+		{"screen terminal", map[string]string{"TERM": "screen-256color"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, name := range []string{"SSH_TTY", "SSH_CONNECTION", "TMUX", "STY", "TERM"} {
+				t.Setenv(name, tt.env[name])
+			}
+			if got := isSSHSession() || inMultiplexer(); got != tt.want {
+				t.Errorf("OSC 52 detected = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Asked for by name, the backend is used wherever scopy runs
+	t.Setenv("SSH_TTY", "")
+	t.Setenv("SSH_CONNECTION", "")
+	t.Setenv("TMUX", "")
+	t.Setenv("STY", "")
+	t.Setenv("TERM", "xterm")
+	backends, err := selectClipboardBackends("osc52")
+	if err != nil || len(backends) != 1 || backends[0].name != "osc52" {
+		t.Errorf("selectClipboardBackends(osc52) = %v, %v", backends, err)
+	}
+	for _, backend := range detectClipboardBackends() {
+		if backend.name == "osc52" {
+			t.Error("osc52 auto-detected in a local terminal")
+		}
+	}
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/dakoctba/scopy/pkg"
+	"github.com/spf13/cobra"
+)
+
+// excludeSource tells where the exclude patterns of the run come from
+var excludeSource string
+
+// applyConfig sets the options not given on the command line from the
+// configuration files, the environment and the selected profile. Precedence,
+// from lowest to highest: defaults, user configuration file, project
+// configuration file, SCOPY_* environment variables, profile, command line.
+func applyConfig(cmd *cobra.Command, args []string) error {
+	if err := applyEnvFlags(cmd); err != nil {
+		return err
+	}
+	if noConfig && profileName != "" {
+		return pkg.NewError(pkg.KindUsage, errors.New("--profile can't be used with --no-config"))
+	}
+
+	configured := pkg.DefaultOptions()
+	var chain pkg.ConfigChain
+	if !noConfig {
+		wd, err := os.Getwd()
+		if err != nil {
+			return pkg.NewError(pkg.KindIO, fmt.Errorf("error reading the current directory: %v", err))
+		}
+		chain, err = pkg.LoadConfigChain(wd, configPath)
+		if err != nil {
+			return pkg.NewError(pkg.KindConfig, fmt.Errorf("error loading configuration: %v", err))
+		}
+		if err := chain.Apply(&configured); err != nil {
+			return err
+		}
+	}
+
+	if err := applyEnvOptions(&configured); err != nil {
+		return err
+	}
+
+	if profileName != "" {
+		if err := chain.ApplyProfile(&configured, profileName); err != nil {
+			return err
+		}
+	}
+
+	// An output destination chosen on the command line replaces the configured one
+	for _, key := range pkg.OutputKeys {
+		if cmd.Flags().Changed(key) {
+			for _, other := range pkg.OutputKeys {
+				configured.CopyOption(&opts, other)
+			}
+			break
+		}
+	}
+
+	for _, key := range pkg.OptionKeys() {
+		if key == "extensions" || cmd.Flags().Changed(key) {
+			continue
+		}
+		opts.CopyOption(&configured, key)
+	}
+
+	excludeSource = optionSource(cmd, chain, "exclude")
+
+	opts.Extensions = args
+	if len(args) == 0 {
+		opts.Extensions = configured.Extensions
+	}
+	return nil
+}
+
+// optionSource returns where the value of the option key comes from, in the
+// order of precedence: the command line, the profile, the environment and
+// the configuration files. It is "" when the option is not set.
+func optionSource(cmd *cobra.Command, chain pkg.ConfigChain, key string) string {
+	if cmd.Flags().Changed(key) {
+		return "--" + key
+	}
+	if profileName != "" {
+		if origin := chain.ProfileOrigin(profileName, key); origin != "" {
+			return origin
+		}
+	}
+	if name, _, ok := lookupEnv(key); ok {
+		return name
+	}
+	return chain.Origin(key)
+}
@@ -0,0 +1,77 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/dakoctba/scopy/pkg"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// envPrefix starts the name of every environment variable read by scopy
+const envPrefix = "SCOPY_"
+
+// envAliases are shorter names accepted for some options
+var envAliases = map[string]string{
+	"SCOPY_FORMAT": "header-format",
+}
+
+// envName returns the environment variable for a flag or option key,
+// e.g. SCOPY_MAX_SIZE for max-size
+func envName(key string) string {
+	return envPrefix + strings.ToUpper(strings.ReplaceAll(key, "-", "_"))
+}
+
+// lookupEnv returns the value of the variable for key or of one of its aliases
+func lookupEnv(key string) (string, string, bool) {
+	if value, ok := os.LookupEnv(envName(key)); ok {
+		return envName(key), value, true
+	}
+	for alias, target := range envAliases {
+		if target != key {
+			continue
+		}
+		if value, ok := os.LookupEnv(alias); ok {
+			return alias, value, true
+		}
+	}
+	return "", "", false
+}
+
+// applyEnvFlags sets the flags that select configuration files (--config,
+// --no-config, --profile) from the environment when they are not given on the
+// command line, since they must be known before any file is loaded
+func applyEnvFlags(cmd *cobra.Command) error {
+	var err error
+	cmd.Flags().VisitAll(func(flag *pflag.Flag) {
+		if err != nil || flag.Changed || !isConfigFlag(flag.Name) {
+			return
+		}
+		if name, value, ok := lookupEnv(flag.Name); ok {
+			if setErr := cmd.Flags().Set(flag.Name, value); setErr != nil {
+				err = pkg.NewError(pkg.KindConfig, fmt.Errorf("invalid value %q for %s: %v", value, name, setErr))
+			}
+		}
+	})
+	return err
+}
+
+// applyEnvOptions sets every option that has an environment variable
+func applyEnvOptions(opts *pkg.Options) error {
+	for _, key := range pkg.OptionKeys() {
+		name, value, ok := lookupEnv(key)
+		if !ok {
+			continue
+		}
+		if err := opts.SetOption(key, value); err != nil {
+			return pkg.NewError(pkg.KindConfig, fmt.Errorf("invalid value %q for %s: %v", value, name, err))
+		}
+	}
+	return nil
+}
+
+func isConfigFlag(name string) bool {
+	return name == "config" || name == "no-config" || name == "profile"
+}
@@ -0,0 +1,37 @@
+package cmd
+
+import (
+	"github.com/dakoctba/scopy/pkg"
+)
+
+// Exit codes, as documented in the README
+const (
+	exitOK             = 0
+	exitUsage          = 1 // Invalid arguments or options
+	exitIO             = 2 // Files or output could not be read or written
+	exitConfig         = 3 // Invalid or unreadable configuration
+	exitPartial        = 4 // Some files could not be processed
+	exitNothingMatched = 5 // No file matched and --fail-on-empty was given
+	exitCanceled       = 6 // Interrupted or timed out
+)
+
+// exitCode maps an error to the exit code of the process. Errors without a
+// kind come from cobra's argument and flag parsing, so they are usage errors.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+	switch pkg.KindOf(err) {
+	case pkg.KindIO:
+		return exitIO
+	case pkg.KindConfig:
+		return exitConfig
+	case pkg.KindPartial:
+		return exitPartial
+	case pkg.KindNothingMatched:
+		return exitNothingMatched
+	case pkg.KindCanceled:
+		return exitCanceled
+	}
+	return exitUsage
+}
@@ -0,0 +1,126 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"text/tabwriter"
+
+	"github.com/dakoctba/scopy/pkg"
+	"github.com/spf13/cobra"
+)
+
+// explainExtensions are the extensions requested with --ext, since the
+// arguments of explain are paths
+var explainExtensions []string
+
+// explainCmd shows how the filter chain decides on files
+var explainCmd = &cobra.Command{
+	Use:   "explain <path>...",
+	Short: "Explain why files are included or excluded",
+	Long: `Explain evaluates files against the same filters as a copy and prints
+each rule, the pattern or limit it matched with its source, and the verdict.
+Filter options are read from flags, configuration files and the environment
+just like in a copy.`,
+	Example: `  scopy explain --ext go cmd/root.go        # Check a file against the .go selection
+  scopy explain -x go -e vendor vendor/a.go # Check an --exclude pattern
+  scopy explain -p review docs/notes.md     # Use the filters of a profile`,
+	Args:          cobra.MinimumNArgs(1),
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		if err := applyConfig(cmd, explainExtensions); err != nil {
+			return err
+		}
+		if len(opts.Extensions) == 0 {
+			return pkg.NewError(pkg.KindUsage, fmt.Errorf("no extensions given: pass them with --ext or set extensions in a configuration file or profile"))
+		}
+		if err := opts.Validate(); err != nil {
+			return err
+		}
+
+		for i, arg := range args {
+			path, err := walkPath(arg)
+			if err != nil {
+				return pkg.NewError(pkg.KindIO, err)
+			}
+			config := opts.ProcessorConfig()
+			config.ExcludeSource = excludeSource
+			explanation, err := pkg.NewProcessor(config).Explain(".", path)
+			if err != nil {
+				return err
+			}
+			if i > 0 {
+				fmt.Println()
+			}
+			if err := writeExplanation(os.Stdout, explanation); err != nil {
+				return pkg.NewError(pkg.KindIO, err)
+			}
+		}
+		return nil
+	},
+}
+
+func init() {
+	explainCmd.Flags().StringSliceVarP(&explainExtensions, "ext", "x", nil, "Extensions or @groups to select (comma-separated)")
+	explainCmd.Flags().StringSliceVarP(&opts.Exclude, "exclude", "e", nil, "Patterns to exclude files/directories (comma-separated)")
+	explainCmd.Flags().VarP(&opts.MaxSize, "max-size", "s", "Maximum size of files to be included")
+	explainCmd.Flags().BoolVarP(&opts.All, "all", "a", false, "Include files & directories beginning with a dot (.)")
+	explainCmd.Flags().BoolVarP(&opts.Follow, "follow", "F", false, "Follow symbolic links")
+	explainCmd.Flags().StringVarP(&profileName, "profile", "p", "", "Apply a named profile from the configuration files")
+	explainCmd.Flags().StringVar(&configPath, "config", "", "Use this configuration file instead of searching for one")
+	explainCmd.Flags().BoolVar(&noConfig, "no-config", false, "Ignore configuration files")
+	explainCmd.MarkFlagsMutuallyExclusive("config", "no-config")
+
+	rootCmd.AddCommand(explainCmd)
+}
+
+// walkPath turns a path given on the command line into the form the walk
+// produces from the current directory, which the filters are matched against
+func walkPath(arg string) (string, error) {
+	path := filepath.Clean(arg)
+	if !filepath.IsAbs(path) {
+		return path, nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(wd, path)
+	if err != nil {
+		return path, nil
+	}
+	return rel, nil
+}
+
+// writeExplanation prints the rules evaluated on a file and the verdict
+func writeExplanation(w io.Writer, explanation pkg.Explanation) error {
+	fmt.Fprintf(w, "%s\n", explanation.Path)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, check := range explanation.Checks {
+		result := "pass"
+		if check.Rejected {
+			result = "reject"
+		}
+		detail := check.Detail
+		if detail == "" {
+			detail = "-"
+		}
+		if check.Source != "" {
+			detail = fmt.Sprintf("%s (%s)", detail, check.Source)
+		}
+		fmt.Fprintf(tw, "  %s\t%s\t%s\n", check.Rule, result, detail)
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if explanation.Verdict == "" {
+		_, err := fmt.Fprintf(w, "Verdict: included\n")
+		return err
+	}
+	_, err := fmt.Fprintf(w, "Verdict: excluded by %s\n", explanation.Verdict)
+	return err
+}
@@ -0,0 +1,46 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"text/tabwriter"
+
+	"github.com/dakoctba/scopy/pkg"
+)
+
+// writeListing prints the files found in list mode, one per line. With
+// details, the bytes, lines and estimated tokens precede each path; rejected
+// candidates are marked with "-" and the rule that left them out.
+func writeListing(w io.Writer, entries []pkg.Entry) error {
+	if !opts.ListDetails {
+		for _, entry := range entries {
+			if err := writeEntry(w, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "BYTES\tLINES\tTOKENS\t  PATH\n")
+	for _, entry := range entries {
+		if !entry.Selected {
+			fmt.Fprintf(tw, "-\t-\t-\t  ")
+		} else {
+			fmt.Fprintf(tw, "%d\t%d\t%d\t  ", entry.Size, entry.Lines, entry.Tokens)
+		}
+		if err := writeEntry(tw, entry); err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+func writeEntry(w io.Writer, entry pkg.Entry) error {
+	if entry.Selected {
+		_, err := fmt.Fprintf(w, "%s\n", entry.Path)
+		return err
+	}
+	_, err := fmt.Fprintf(w, "- %s (%s: %s)\n", entry.Path, entry.Reason, entry.Detail)
+	return err
+}
@@ -0,0 +1,139 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/dakoctba/scopy/pkg"
+)
+
+// outputSink is the destination of the generated content
+type outputSink interface {
+	io.Writer
+	// Finish delivers the content once processing succeeded
+	Finish() error
+	// Abort discards the content after a failure
+	Abort()
+}
+
+// openOutput creates the sink selected by the output flags. Explicit flags
+// win; otherwise the content goes to the clipboard when stdout is a terminal
+// and to stdout when it is redirected. A file listing goes to stdout unless
+// the clipboard is asked for.
+func openOutput() (outputSink, error) {
+	switch {
+	case opts.Output != "":
+		file, err := pkg.CreateOutputFile(opts.Output)
+		if err != nil {
+			return nil, err
+		}
+		return &fileSink{file: file, path: opts.Output}, nil
+	case opts.Pipe != "":
+		sink, err := pkg.StartCommandSink(opts.Pipe)
+		if err != nil {
+			return nil, err
+		}
+		return &pipeSink{sink}, nil
+	case opts.Stdout:
+		return newStdoutSink(), nil
+	case opts.Clipboard, isTerminal(os.Stdout) && !opts.ListMode():
+		backends, err := selectClipboardBackends(opts.ClipboardBackend)
+		if err != nil {
+			return nil, err
+		}
+		return &clipboardSink{LimitedBuffer: pkg.NewLimitedBuffer(int64(opts.ClipboardLimit)), backends: backends}, nil
+	default:
+		return newStdoutSink(), nil
+	}
+}
+
+// isTerminal reports whether f is attached to a terminal.
+// A file that can't be inspected is treated as redirected.
+func isTerminal(f *os.File) bool {
+	info, err := f.Stat()
+	if err != nil {
+		return false
+	}
+	return info.Mode()&os.ModeCharDevice != 0
+}
+
+// stdoutSink writes buffered content to stdout. The content is streamed, so
+// only what is still buffered can be discarded by Abort.
+type stdoutSink struct {
+	*bufio.Writer
+}
+
+func newStdoutSink() *stdoutSink {
+	return &stdoutSink{bufio.NewWriter(os.Stdout)}
+}
+
+func (s *stdoutSink) Finish() error {
+	return s.Flush()
+}
+
+func (s *stdoutSink) Abort() {
+	s.Reset(io.Discard)
+}
+
+// clipboardSink collects the content, up to a size limit, and copies it to the
+// clipboard. When no backend works, the content is saved to a temporary file
+// and the run still fails, so scripts notice the clipboard wasn't set.
+type clipboardSink struct {
+	*pkg.LimitedBuffer
+	backends []clipboardBackend
+}
+
+func (s *clipboardSink) Finish() error {
+	content := s.String()
+	backend, err := copyToClipboard(content, s.backends)
+	if err == nil {
+		fmt.Fprintf(os.Stderr, "Content copied to clipboard (%s)!\n", backend)
+		return nil
+	}
+
+	path, saveErr := saveToTempFile(content)
+	if saveErr != nil {
+		return fmt.Errorf("could not copy to clipboard (%v) nor save the content: %v", err, saveErr)
+	}
+	return fmt.Errorf("could not copy to clipboard: %v; content saved to %s", err, path)
+}
+
+func (s *clipboardSink) Abort() {}
+
+// fileSink writes the content to a file atomically
+type fileSink struct {
+	file *pkg.OutputFile
+	path string
+}
+
+func (s *fileSink) Write(p []byte) (int, error) {
+	return s.file.Write(p)
+}
+
+func (s *fileSink) Finish() error {
+	if err := s.file.Commit(); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Content written to %s\n", s.path)
+	return nil
+}
+
+func (s *fileSink) Abort() {
+	s.file.Abort()
+}
+
+// pipeSink streams the content to the standard input of a command, which is
+// killed by Abort
+type pipeSink struct {
+	*pkg.CommandSink
+}
+
+func (s *pipeSink) Finish() error {
+	return s.Close()
+}
+
+func (s *pipeSink) Abort() {
+	s.Kill()
+}
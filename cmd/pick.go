@@ -0,0 +1,151 @@
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dakoctba/scopy/pkg"
+	"github.com/spf13/cobra"
+	"golang.org/x/term"
+)
+
+// pickSetName is the set the picked files are saved as, with --save
+var pickSetName string
+
+// pickCmd selects the files to copy interactively
+var pickCmd = &cobra.Command{
+	Use:   "pick [extensions...]",
+	Short: "Pick the files to copy interactively",
+	Long: `Pick runs the usual selection in the current directory, then shows the
+candidates as a tree with checkboxes. The chosen files are copied to the
+selected output like a normal run, and can be saved as a named set.
+
+Keys: ↑↓ or j/k move, →← or l/h expand and collapse, space toggles a file or
+directory, a toggles everything shown, / searches, tab shows a preview, s saves
+the selection as a set, enter copies it and q or esc quits.`,
+	Example: `  scopy pick go                   # Pick among the .go files
+  scopy pick @web -e node_modules # Pick among web files
+  scopy pick go --save api        # Also save the pick as the set "api"`,
+	Args:          cobra.ArbitraryArgs,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		if err := prepareRun(cmd, args); err != nil {
+			return err
+		}
+		if err := checkWorkingTree("pick"); err != nil {
+			return err
+		}
+		if pickSetName != "" {
+			if err := pkg.ValidateSetName(pickSetName); err != nil {
+				return pkg.NewError(pkg.KindUsage, err)
+			}
+		}
+
+		// The candidates are the files a normal run would copy
+		config := opts.ProcessorConfig()
+		config.ListOnly = true
+		config.ListDetails = false
+		config.ListRejected = false
+		scan := pkg.NewProcessor(config)
+		if err := scan.Process("."); err != nil && pkg.KindOf(err) != pkg.KindPartial {
+			return pkg.NewError(pkg.KindIO, fmt.Errorf("error selecting files: %v", err))
+		}
+		entries := scan.GetEntries()
+		if len(entries) == 0 {
+			if opts.FailOnEmpty {
+				return pkg.ErrNothingMatched
+			}
+			return pkg.NewError(pkg.KindIO, errors.New("no files match the selection"))
+		}
+
+		p := newPicker(entries)
+		p.save = func(name string, paths []string) error {
+			return pkg.SaveFileSet(".", name, pickedSet(paths))
+		}
+		if err := runPicker(p); err != nil {
+			return pkg.NewError(pkg.KindIO, err)
+		}
+		if p.canceled {
+			return pkg.NewError(pkg.KindCanceled, errors.New("pick canceled; nothing was delivered"))
+		}
+
+		paths := p.selectedPaths()
+		if pickSetName != "" {
+			if err := pkg.SaveFileSet(".", pickSetName, pickedSet(paths)); err != nil {
+				return pkg.NewError(pkg.KindIO, fmt.Errorf("error saving set: %v", err))
+			}
+		}
+		files := make([]pkg.FileSpec, len(paths))
+		for i, path := range paths {
+			files[i] = pkg.FileSpec{Path: path}
+		}
+		return runBundle(func(ctx context.Context, processor *pkg.Processor) error {
+			return processor.ProcessFiles(ctx, files)
+		})
+	},
+}
+
+// pickedSet makes a set of the picked files
+func pickedSet(paths []string) pkg.FileSet {
+	set := pkg.FileSet{}
+	for _, path := range paths {
+		set.Files = append(set.Files, pkg.SetEntry{Path: filepath.ToSlash(path)})
+	}
+	return set
+}
+
+// runPicker runs p on the terminal until a selection is confirmed or the
+// picker is canceled. The terminal is used directly, so the output can
+// still be redirected.
+func runPicker(p *picker) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return fmt.Errorf("pick needs a terminal: %v", err)
+	}
+	defer tty.Close()
+
+	fd := int(tty.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return fmt.Errorf("pick needs a terminal: %v", err)
+	}
+	defer term.Restore(fd, state)
+
+	// Alternate screen with a hidden cursor, restored on the way out
+	fmt.Fprint(tty, "\033[?1049h\033[?25l")
+	defer fmt.Fprint(tty, "\033[?25h\033[?1049l")
+
+	buf := make([]byte, 256)
+	for !p.done && !p.canceled {
+		width, height, err := term.GetSize(fd)
+		if err != nil {
+			width, height = 80, 24
+		}
+		lines := p.view(width, height)
+		if _, err := fmt.Fprint(tty, "\033[H"+strings.Join(lines, "\r\n")); err != nil {
+			return err
+		}
+
+		n, err := tty.Read(buf)
+		if err != nil {
+			return err
+		}
+		for _, key := range parseKeys(buf[:n]) {
+			p.handleKey(key)
+		}
+	}
+	return nil
+}
+
+func init() {
+	addRunFlags(pickCmd)
+	pickCmd.Flags().StringVar(&pickSetName, "save", "", "Save the picked files as a named set")
+
+	rootCmd.AddCommand(pickCmd)
+}
@@ -0,0 +1,679 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dakoctba/scopy/pkg"
+)
+
+// previewLimit is how much of a file is read for its preview
+const previewLimit = 32 * 1024
+
+// pickNode is a file or directory of the picker tree
+type pickNode struct {
+	name     string
+	path     string
+	size     int64
+	dir      bool
+	expanded bool
+	checked  bool // Files only: directories derive their state from their files
+	parent   *pickNode
+	children []*pickNode
+}
+
+// pickRow is a line of the list: a node and its indentation
+type pickRow struct {
+	node  *pickNode
+	depth int
+}
+
+// pickMode is what the keys being typed go to
+type pickMode int
+
+const (
+	pickBrowse pickMode = iota // Move, toggle and expand
+	pickSearch                 // Type the fuzzy search query
+	pickSave                   // Type the name of the set to save
+)
+
+// picker is the state of the interactive picker, independent of the terminal
+type picker struct {
+	root    *pickNode
+	files   []*pickNode // In walk order, which is the order of the output
+	rows    []pickRow
+	cursor  int
+	offset  int
+	height  int // Rows of the list in the last view, for paging
+	mode    pickMode
+	query   string
+	input   string
+	preview bool
+	message string
+
+	// save stores the checked paths as the named set
+	save func(name string, paths []string) error
+
+	previewPath  string
+	previewLines []string
+
+	done     bool
+	canceled bool
+}
+
+// newPicker builds the tree of the candidate entries
+func newPicker(entries []pkg.Entry) *picker {
+	p := &picker{root: &pickNode{dir: true, expanded: true}}
+	dirs := map[string]*pickNode{"": p.root}
+
+	var dirNode func(dir string) *pickNode
+	dirNode = func(dir string) *pickNode {
+		if node, ok := dirs[dir]; ok {
+			return node
+		}
+		parent := dirNode(parentDir(dir))
+		node := &pickNode{name: path.Base(dir), path: dir, dir: true, parent: parent}
+		parent.children = append(parent.children, node)
+		dirs[dir] = node
+		return node
+	}
+
+	for _, entry := range entries {
+		file := toSlash(entry.Path)
+		parent := dirNode(parentDir(file))
+		node := &pickNode{name: path.Base(file), path: entry.Path, size: entry.Size, parent: parent}
+		parent.children = append(parent.children, node)
+		p.files = append(p.files, node)
+	}
+
+	p.refresh()
+	return p
+}
+
+// parentDir is path.Dir with "" for the root
+func parentDir(file string) string {
+	dir := path.Dir(file)
+	if dir == "." {
+		return ""
+	}
+	return dir
+}
+
+func toSlash(file string) string {
+	return strings.ReplaceAll(file, string(os.PathSeparator), "/")
+}
+
+// refresh rebuilds the visible rows: the expanded tree, or the files matching
+// the query ordered by score
+func (p *picker) refresh() {
+	p.rows = p.rows[:0]
+	if query := strings.TrimSpace(p.query); query != "" {
+		type match struct {
+			node  *pickNode
+			score int
+		}
+		var matches []match
+		for _, file := range p.files {
+			if score, ok := fuzzyScore(query, toSlash(file.path)); ok {
+				matches = append(matches, match{file, score})
+			}
+		}
+		sort.SliceStable(matches, func(i, j int) bool {
+			return matches[i].score > matches[j].score
+		})
+		for _, m := range matches {
+			p.rows = append(p.rows, pickRow{node: m.node})
+		}
+	} else {
+		var add func(node *pickNode, depth int)
+		add = func(node *pickNode, depth int) {
+			for _, child := range node.children {
+				p.rows = append(p.rows, pickRow{node: child, depth: depth})
+				if child.dir && child.expanded {
+					add(child, depth+1)
+				}
+			}
+		}
+		add(p.root, 0)
+	}
+	p.moveTo(p.cursor)
+}
+
+// moveTo puts the cursor on row i, within the list
+func (p *picker) moveTo(i int) {
+	if i >= len(p.rows) {
+		i = len(p.rows) - 1
+	}
+	if i < 0 {
+		i = 0
+	}
+	p.cursor = i
+}
+
+// current returns the node under the cursor, if any
+func (p *picker) current() *pickNode {
+	if p.cursor < len(p.rows) {
+		return p.rows[p.cursor].node
+	}
+	return nil
+}
+
+// fuzzyScore matches query against target as a case-insensitive subsequence.
+// Consecutive matches and matches at the start of a path component or of
+// the file name score higher, gaps lower.
+func fuzzyScore(query, target string) (int, bool) {
+	q := []rune(strings.ToLower(query))
+	t := []rune(strings.ToLower(target))
+	base := strings.LastIndex(target, "/") + 1
+
+	score, qi, last := 0, 0, -1
+	for ti := 0; ti < len(t) && qi < len(q); ti++ {
+		if t[ti] != q[qi] {
+			continue
+		}
+		score += 10
+		switch {
+		case last == ti-1:
+			score += 15
+		case last >= 0:
+			score -= ti - last - 1
+		}
+		if ti == 0 || strings.ContainsRune("/_-.", t[ti-1]) {
+			score += 10
+		}
+		if ti >= base {
+			score += 5
+		}
+		last = ti
+		qi++
+	}
+	return score, qi == len(q)
+}
+
+// checkState returns how many files under node are checked, out of how many
+func checkState(node *pickNode) (checked, total int) {
+	if !node.dir {
+		if node.checked {
+			return 1, 1
+		}
+		return 0, 1
+	}
+	for _, child := range node.children {
+		c, t := checkState(child)
+		checked += c
+		total += t
+	}
+	return checked, total
+}
+
+// setChecked checks or unchecks node and, for a directory, all its files
+func setChecked(node *pickNode, checked bool) {
+	node.checked = checked && !node.dir
+	for _, child := range node.children {
+		setChecked(child, checked)
+	}
+}
+
+// toggle checks node unless it is fully checked already
+func toggle(node *pickNode) {
+	checked, total := checkState(node)
+	setChecked(node, checked < total)
+}
+
+// toggleRows checks all the visible files unless they all are already
+func (p *picker) toggleRows() {
+	all := true
+	for _, row := range p.rows {
+		if checked, total := checkState(row.node); checked < total {
+			all = false
+		}
+	}
+	for _, row := range p.rows {
+		setChecked(row.node, !all)
+	}
+}
+
+// selection returns the checked files in walk order
+func (p *picker) selection() []*pickNode {
+	var files []*pickNode
+	for _, file := range p.files {
+		if file.checked {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// selectedPaths returns the paths of the checked files in walk order
+func (p *picker) selectedPaths() []string {
+	var paths []string
+	for _, file := range p.selection() {
+		paths = append(paths, file.path)
+	}
+	return paths
+}
+
+// handleKey applies a key, as returned by parseKeys
+func (p *picker) handleKey(key string) {
+	if key == "ctrl-c" {
+		p.canceled = true
+		return
+	}
+	p.message = ""
+
+	switch p.mode {
+	case pickSearch:
+		switch key {
+		case "enter":
+			p.mode = pickBrowse
+		case "esc":
+			p.query = ""
+			p.mode = pickBrowse
+			p.refresh()
+		case "backspace":
+			p.query = dropLastRune(p.query)
+			p.cursor = 0
+			p.refresh()
+		case "up", "down", "pgup", "pgdown":
+			p.move(key)
+		default:
+			if isPrintable(key) {
+				p.query += key
+				p.cursor = 0
+				p.refresh()
+			}
+		}
+		return
+
+	case pickSave:
+		switch key {
+		case "enter":
+			p.mode = pickBrowse
+			p.saveSet(strings.TrimSpace(p.input))
+		case "esc":
+			p.mode = pickBrowse
+		case "backspace":
+			p.input = dropLastRune(p.input)
+		default:
+			if isPrintable(key) {
+				p.input += key
+			}
+		}
+		return
+	}
+
+	node := p.current()
+	switch key {
+	case "up", "k", "down", "j", "pgup", "pgdown", "home", "g", "end", "G":
+		p.move(key)
+	case "right", "l":
+		if node != nil && node.dir {
+			if node.expanded {
+				p.moveTo(p.cursor + 1)
+			} else {
+				node.expanded = true
+				p.refresh()
+			}
+		}
+	case "left", "h":
+		switch {
+		case node == nil:
+		case node.dir && node.expanded:
+			node.expanded = false
+			p.refresh()
+		case p.query == "" && node.parent != p.root:
+			for i, row := range p.rows {
+				if row.node == node.parent {
+					p.moveTo(i)
+				}
+			}
+		}
+	case " ":
+		if node != nil {
+			toggle(node)
+		}
+	case "a":
+		p.toggleRows()
+	case "/":
+		p.mode = pickSearch
+	case "tab", "p":
+		p.preview = !p.preview
+	case "s":
+		if len(p.selection()) == 0 {
+			p.message = "Nothing to save: check files with space"
+			return
+		}
+		p.mode = pickSave
+		p.input = ""
+	case "enter":
+		if len(p.selection()) == 0 {
+			p.message = "Nothing selected: check files with space"
+			return
+		}
+		p.done = true
+	case "esc":
+		if p.query != "" {
+			p.query = ""
+			p.refresh()
+			return
+		}
+		p.canceled = true
+	case "q":
+		p.canceled = true
+	}
+}
+
+// move moves the cursor by a row, a page or to an end of the list
+func (p *picker) move(key string) {
+	page := p.height
+	if page < 1 {
+		page = 1
+	}
+	switch key {
+	case "up", "k":
+		p.moveTo(p.cursor - 1)
+	case "down", "j":
+		p.moveTo(p.cursor + 1)
+	case "pgup":
+		p.moveTo(p.cursor - page)
+	case "pgdown":
+		p.moveTo(p.cursor + page)
+	case "home", "g":
+		p.moveTo(0)
+	case "end", "G":
+		p.moveTo(len(p.rows) - 1)
+	}
+}
+
+// saveSet saves the checked files as the set name
+func (p *picker) saveSet(name string) {
+	if p.save == nil || name == "" {
+		return
+	}
+	paths := p.selectedPaths()
+	if err := p.save(name, paths); err != nil {
+		p.message = "Error: " + err.Error()
+		return
+	}
+	p.message = fmt.Sprintf("Saved set %q (%d files)", name, len(paths))
+}
+
+// view renders the picker as width x height cells, one string per line
+func (p *picker) view(width, height int) []string {
+	p.height = height - 3
+	if p.height < 1 {
+		p.height = 1
+	}
+	if p.cursor < p.offset {
+		p.offset = p.cursor
+	}
+	if p.cursor >= p.offset+p.height {
+		p.offset = p.cursor - p.height + 1
+	}
+
+	lines := make([]string, 0, height)
+
+	// Header: the search query or the number of candidates
+	switch {
+	case p.mode == pickSearch:
+		lines = append(lines, fit(fmt.Sprintf(" Search: %s_  (%d matches)", p.query, len(p.rows)), width))
+	case p.query != "":
+		lines = append(lines, fit(fmt.Sprintf(" Search: %s  (%d matches, esc to clear)", p.query, len(p.rows)), width))
+	default:
+		lines = append(lines, fit(fmt.Sprintf(" Pick files (%d candidates)", len(p.files)), width))
+	}
+
+	listWidth := width
+	var preview []string
+	if p.preview && width >= 40 {
+		listWidth = width / 2
+		preview = p.previewView(p.height, width-listWidth-1)
+	}
+
+	for i := 0; i < p.height; i++ {
+		row := ""
+		if r := p.offset + i; r < len(p.rows) {
+			row = fit(p.rowText(p.rows[r]), listWidth)
+			if r == p.cursor {
+				row = "\033[7m" + row + "\033[0m"
+			}
+		} else {
+			row = fit("", listWidth)
+		}
+		if preview != nil {
+			row += "│" + preview[i]
+		}
+		lines = append(lines, row)
+	}
+
+	// Totals of the selection, updated on every key
+	var size, tokens int64
+	selection := p.selection()
+	for _, file := range selection {
+		size += file.size
+		tokens += pkg.EstimateTokens(file.size)
+	}
+	lines = append(lines, fit(fmt.Sprintf(" %d files selected, %s, ~%d tokens", len(selection), pkg.HumanSize(size), tokens), width))
+
+	var footer string
+	switch {
+	case p.mode == pickSave:
+		footer = fmt.Sprintf(" Save set as: %s_  (enter to save, esc to cancel)", p.input)
+	case p.message != "":
+		footer = " " + p.message
+	case p.mode == pickSearch:
+		footer = " Type to filter, ↑↓ move, enter keep filter, esc clear"
+	default:
+		footer = " space toggle  a all  →← expand  / search  tab preview  s save set  enter copy  q quit"
+	}
+	lines = append(lines, fit(footer, width))
+	return lines
+}
+
+// rowText formats a row: indentation, expansion marker, checkbox, name and size
+func (p *picker) rowText(row pickRow) string {
+	node := row.node
+	marker := "  "
+	if node.dir {
+		marker = "▸ "
+		if node.expanded {
+			marker = "▾ "
+		}
+	}
+	box := "[ ]"
+	switch checked, total := checkState(node); {
+	case checked == total:
+		box = "[x]"
+	case checked > 0:
+		box = "[-]"
+	}
+
+	name := node.name
+	if p.query != "" {
+		name = toSlash(node.path)
+	}
+	if node.dir {
+		name += "/"
+	}
+	return fmt.Sprintf(" %s%s%s %s  %s", strings.Repeat("  ", row.depth), marker, box, name, pkg.HumanSize(treeSize(node)))
+}
+
+// treeSize is the size of a file or of all files under a directory
+func treeSize(node *pickNode) int64 {
+	size := node.size
+	for _, child := range node.children {
+		size += treeSize(child)
+	}
+	return size
+}
+
+// previewView renders the start of the file under the cursor, or the
+// content of a directory
+func (p *picker) previewView(height, width int) []string {
+	node := p.current()
+	var text []string
+	switch {
+	case node == nil:
+	case node.dir:
+		checked, total := checkState(node)
+		text = append(text, fmt.Sprintf("%s/: %d files, %d selected, %s", node.path, total, checked, pkg.HumanSize(treeSize(node))))
+		for _, child := range node.children {
+			name := child.name
+			if child.dir {
+				name += "/"
+			}
+			text = append(text, "  "+name)
+		}
+	default:
+		if p.previewPath != node.path {
+			p.previewPath = node.path
+			p.previewLines = readPreview(node.path)
+		}
+		text = p.previewLines
+	}
+
+	lines := make([]string, height)
+	for i := range lines {
+		line := ""
+		if i < len(text) {
+			line = " " + text[i]
+		}
+		lines[i] = fit(line, width)
+	}
+	return lines
+}
+
+// readPreview reads the first lines of a file for the preview pane
+func readPreview(file string) []string {
+	f, err := os.Open(file)
+	if err != nil {
+		return []string{"Error: " + err.Error()}
+	}
+	defer f.Close()
+	data, err := io.ReadAll(io.LimitReader(f, previewLimit))
+	if err != nil {
+		return []string{"Error: " + err.Error()}
+	}
+	if len(data) == 0 {
+		return []string{"(empty file)"}
+	}
+	return strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+}
+
+// fit makes s exactly width cells wide: tabs are expanded, control
+// characters dropped, and the text is cut or padded with spaces
+func fit(s string, width int) string {
+	var b strings.Builder
+	n := 0
+	for _, r := range s {
+		if n >= width {
+			break
+		}
+		switch {
+		case r == '\t':
+			for i := 0; i < 4 && n < width; i++ {
+				b.WriteByte(' ')
+				n++
+			}
+		case r == utf8.RuneError, !unicode.IsPrint(r) && r != ' ':
+		default:
+			b.WriteRune(r)
+			n++
+		}
+	}
+	if n < width {
+		b.WriteString(strings.Repeat(" ", width-n))
+	}
+	return b.String()
+}
+
+// isPrintable reports whether key is text rather than a named key
+func isPrintable(key string) bool {
+	r, size := utf8.DecodeRuneInString(key)
+	return size == len(key) && size > 0 && unicode.IsPrint(r)
+}
+
+func dropLastRune(s string) string {
+	if s == "" {
+		return s
+	}
+	_, size := utf8.DecodeLastRuneInString(s)
+	return s[:len(s)-size]
+}
+
+// parseKeys splits terminal input into keys: named keys such as "up",
+// "enter" or "ctrl-c", or the text of a printable character
+func parseKeys(b []byte) []string {
+	var keys []string
+	for len(b) > 0 {
+		key, n := parseKey(b)
+		if key != "" {
+			keys = append(keys, key)
+		}
+		b = b[n:]
+	}
+	return keys
+}
+
+func parseKey(b []byte) (string, int) {
+	switch b[0] {
+	case 0x1b:
+		if len(b) >= 3 && (b[1] == '[' || b[1] == 'O') {
+			// Escape sequence: parameters up to a final byte in 0x40-0x7e
+			end := 2
+			for end < len(b) && (b[end] < 0x40 || b[end] > 0x7e) {
+				end++
+			}
+			if end == len(b) {
+				return "", len(b)
+			}
+			params := string(b[2:end])
+			switch b[end] {
+			case 'A':
+				return "up", end + 1
+			case 'B':
+				return "down", end + 1
+			case 'C':
+				return "right", end + 1
+			case 'D':
+				return "left", end + 1
+			case 'H':
+				return "home", end + 1
+			case 'F':
+				return "end", end + 1
+			case '~':
+				switch params {
+				case "5":
+					return "pgup", end + 1
+				case "6":
+					return "pgdown", end + 1
+				case "1", "7":
+					return "home", end + 1
+				case "4", "8":
+					return "end", end + 1
+				}
+			}
+			return "", end + 1
+		}
+		return "esc", 1
+	case '\r', '\n':
+		return "enter", 1
+	case '\t':
+		return "tab", 1
+	case 0x7f, 0x08:
+		return "backspace", 1
+	case 0x03:
+		return "ctrl-c", 1
+	}
+	r, n := utf8.DecodeRune(b)
+	if r == utf8.RuneError || r < 0x20 {
+		return "", n
+	}
+	return string(r), n
+}
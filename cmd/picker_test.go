@@ -0,0 +1,387 @@
+package cmd
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dakoctba/scopy/pkg"
+)
+
+// testEntries are the candidates of the picker tests, in walk order
+var testEntries = []pkg.Entry{
+	{Path: "cmd/root.go", Size: 100},
+	{Path: "cmd/set.go", Size: 200},
+	{Path: "main.go", Size: 50},
+	{Path: "pkg/bundle/bundle.go", Size: 300},
+	{Path: "pkg/processor.go", Size: 400},
+}
+
+// typeKeys feeds terminal input to the picker, as the raw-mode loop does
+func typeKeys(p *picker, input string) {
+	for _, key := range parseKeys([]byte(input)) {
+		p.handleKey(key)
+	}
+}
+
+// rowTexts returns the visible rows as rendered, without the cursor
+func rowTexts(p *picker) []string {
+	var rows []string
+	for _, row := range p.rows {
+		rows = append(rows, p.rowText(row))
+	}
+	return rows
+}
+
+func TestPickerKeys(t *testing.T) {
+	tests := []struct {
+		name      string
+		keys      string
+		selection []string
+		rows      []string
+		cursor    int
+		done      bool
+		canceled  bool
+		message   string
+	}{
+		{
+			name: "initial tree",
+			rows: []string{" ▸ [ ] cmd/  300 B", "   [ ] main.go  50 B", " ▸ [ ] pkg/  700 B"},
+		},
+		{
+			// Toggling a collapsed directory checks every file under it
+			name:      "toggle directory",
+			keys:      " ",
+			selection: []string{"cmd/root.go", "cmd/set.go"},
+			rows:      []string{" ▸ [x] cmd/  300 B", "   [ ] main.go  50 B", " ▸ [ ] pkg/  700 B"},
+		},
+		{
+			name:      "toggle directory twice",
+			keys:      "  ",
+			selection: nil,
+			rows:      []string{" ▸ [ ] cmd/  300 B", "   [ ] main.go  50 B", " ▸ [ ] pkg/  700 B"},
+		},
+		{
+			// A directory with some files checked is partly checked
+			name:      "expand and toggle a file",
+			keys:      "lj ",
+			selection: []string{"cmd/root.go"},
+			rows: []string{
+				" ▾ [-] cmd/  300 B",
+				"     [x] root.go  100 B", "     [ ] set.go  200 B",
+				"   [ ] main.go  50 B", " ▸ [ ] pkg/  700 B",
+			},
+			cursor: 1,
+		},
+		{
+			// Checking every file of a directory one by one checks it, up to
+			// the top
+			name:      "propagation to parents",
+			keys:      "Gljlj j ",
+			selection: []string{"pkg/bundle/bundle.go", "pkg/processor.go"},
+			rows: []string{
+				" ▸ [ ] cmd/  300 B", "   [ ] main.go  50 B",
+				" ▾ [x] pkg/  700 B",
+				"   ▾ [x] bundle/  300 B", "       [x] bundle.go  300 B",
+				"     [x] processor.go  400 B",
+			},
+			cursor: 5,
+		},
+		{
+			name:   "collapse with left",
+			keys:   "l\x1b[D",
+			rows:   []string{" ▸ [ ] cmd/  300 B", "   [ ] main.go  50 B", " ▸ [ ] pkg/  700 B"},
+			cursor: 0,
+		},
+		{
+			// Left on a file goes to its directory
+			name: "left to parent",
+			keys: "ljjh",
+			rows: []string{
+				" ▾ [ ] cmd/  300 B", "     [ ] root.go  100 B", "     [ ] set.go  200 B",
+				"   [ ] main.go  50 B", " ▸ [ ] pkg/  700 B",
+			},
+			cursor: 0,
+		},
+		{
+			name:      "toggle all visible rows",
+			keys:      "a",
+			selection: []string{"cmd/root.go", "cmd/set.go", "main.go", "pkg/bundle/bundle.go", "pkg/processor.go"},
+			rows:      []string{" ▸ [x] cmd/  300 B", "   [x] main.go  50 B", " ▸ [x] pkg/  700 B"},
+		},
+		{
+			name:      "toggle all when some are checked",
+			keys:      "j a",
+			selection: []string{"cmd/root.go", "cmd/set.go", "main.go", "pkg/bundle/bundle.go", "pkg/processor.go"},
+			rows:      []string{" ▸ [x] cmd/  300 B", "   [x] main.go  50 B", " ▸ [x] pkg/  700 B"},
+			cursor:    1,
+		},
+		{
+			// The filter lists the matching files by path, best match first
+			name:   "search",
+			keys:   "/set",
+			rows:   []string{"   [ ] cmd/set.go  200 B"},
+			cursor: 0,
+		},
+		{
+			name:      "search and toggle",
+			keys:      "/proc\r ",
+			selection: []string{"pkg/processor.go"},
+			rows:      []string{"   [x] pkg/processor.go  400 B"},
+		},
+		{
+			// Toggling all in a filter only touches the matching files
+			name:      "search and toggle all",
+			keys:      "/go\x7f\x7froot\ra",
+			selection: []string{"cmd/root.go"},
+			rows:      []string{"   [x] cmd/root.go  100 B"},
+		},
+		{
+			name: "search cleared with esc",
+			keys: "/zzz\x1b",
+			rows: []string{" ▸ [ ] cmd/  300 B", "   [ ] main.go  50 B", " ▸ [ ] pkg/  700 B"},
+		},
+		{
+			name:      "selection kept after the filter is cleared",
+			keys:      "/main\r \x1b",
+			selection: []string{"main.go"},
+			rows:      []string{" ▸ [ ] cmd/  300 B", "   [x] main.go  50 B", " ▸ [ ] pkg/  700 B"},
+		},
+		{
+			name:    "enter without selection",
+			keys:    "\r",
+			rows:    []string{" ▸ [ ] cmd/  300 B", "   [ ] main.go  50 B", " ▸ [ ] pkg/  700 B"},
+			message: "Nothing selected: check files with space",
+		},
+		{
+			name:      "enter copies the selection",
+			keys:      "j \r",
+			selection: []string{"main.go"},
+			rows:      []string{" ▸ [ ] cmd/  300 B", "   [x] main.go  50 B", " ▸ [ ] pkg/  700 B"},
+			cursor:    1,
+			done:      true,
+		},
+		{
+			name:     "quit",
+			keys:     " q",
+			rows:     []string{" ▸ [x] cmd/  300 B", "   [ ] main.go  50 B", " ▸ [ ] pkg/  700 B"},
+			canceled: true,
+
+			selection: []string{"cmd/root.go", "cmd/set.go"},
+		},
+		{
+			name:     "ctrl-c while searching",
+			keys:     "/ma\x03",
+			rows:     []string{"   [ ] main.go  50 B"},
+			canceled: true,
+		},
+		{
+			// The cursor stays within the list
+			name:   "moves past the ends",
+			keys:   "kkk\x1b[B\x1b[B\x1b[B\x1b[B",
+			rows:   []string{" ▸ [ ] cmd/  300 B", "   [ ] main.go  50 B", " ▸ [ ] pkg/  700 B"},
+			cursor: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPicker(testEntries)
+			typeKeys(p, tt.keys)
+
+			if got := p.selectedPaths(); !reflect.DeepEqual(got, tt.selection) {
+				t.Errorf("selection = %q, want %q", got, tt.selection)
+			}
+			if got := rowTexts(p); !reflect.DeepEqual(got, tt.rows) {
+				t.Errorf("rows:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(tt.rows, "\n"))
+			}
+			if p.cursor != tt.cursor {
+				t.Errorf("cursor = %d, want %d", p.cursor, tt.cursor)
+			}
+			if p.done != tt.done || p.canceled != tt.canceled {
+				t.Errorf("done, canceled = %v, %v, want %v, %v", p.done, p.canceled, tt.done, tt.canceled)
+			}
+			if p.message != tt.message {
+				t.Errorf("message = %q, want %q", p.message, tt.message)
+			}
+		})
+	}
+}
+
+func TestPickerSave(t *testing.T) {
+	tests := []struct {
+		name    string
+		keys    string
+		err     error
+		saved   string
+		paths   []string
+		message string
+	}{
+		{
+			name:    "nothing checked",
+			keys:    "s",
+			message: "Nothing to save: check files with space",
+		},
+		{
+			name:    "save",
+			keys:    " sapi\r",
+			saved:   "api",
+			paths:   []string{"cmd/root.go", "cmd/set.go"},
+			message: `Saved set "api" (2 files)`,
+		},
+		{
+			name:  "name edited",
+			keys:  "j sapx\x7fi\r",
+			saved: "api", paths: []string{"main.go"},
+			message: `Saved set "api" (1 files)`,
+		},
+		{
+			name: "canceled",
+			keys: " sapi\x1b",
+		},
+		{
+			name:    "error",
+			keys:    " sapi\r",
+			err:     errors.New("disk full"),
+			saved:   "api",
+			paths:   []string{"cmd/root.go", "cmd/set.go"},
+			message: "Error: disk full",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := newPicker(testEntries)
+			var saved string
+			var paths []string
+			p.save = func(name string, files []string) error {
+				saved, paths = name, files
+				return tt.err
+			}
+			typeKeys(p, tt.keys)
+
+			if saved != tt.saved || !reflect.DeepEqual(paths, tt.paths) {
+				t.Errorf("saved %q with %q, want %q with %q", saved, paths, tt.saved, tt.paths)
+			}
+			if p.message != tt.message {
+				t.Errorf("message = %q, want %q", p.message, tt.message)
+			}
+			if p.mode != pickBrowse {
+				t.Errorf("mode = %v, want browse", p.mode)
+			}
+		})
+	}
+}
+
+func TestPickerView(t *testing.T) {
+	p := newPicker(testEntries)
+	typeKeys(p, "j ")
+
+	got := p.view(40, 6)
+	want := []string{
+		" Pick files (5 candidates)              ",
+		" ▸ [ ] cmd/  300 B                      ",
+		"\033[7m   [x] main.go  50 B                    \033[0m",
+		" ▸ [ ] pkg/  700 B                      ",
+		" 1 files selected, 50 B, ~13 tokens     ",
+		" space toggle  a all  →← expand  / searc",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("view:\n%q\nwant:\n%q", got, want)
+	}
+
+	// The list scrolls to keep the cursor visible
+	typeKeys(p, "Gl/")
+	got = p.view(40, 5)
+	want = []string{
+		" Search: _  (5 matches)                 ",
+		"   [x] main.go  50 B                    ",
+		"\033[7m ▾ [ ] pkg/  700 B                      \033[0m",
+		" 1 files selected, 50 B, ~13 tokens     ",
+		" Type to filter, ↑↓ move, enter keep fil",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("view after scrolling:\n%q\nwant:\n%q", got, want)
+	}
+
+	// The preview of a directory lists its content
+	typeKeys(p, "\x1b\t")
+	got = p.view(60, 5)
+	want = []string{
+		" Pick files (5 candidates)                                  ",
+		"   [x] main.go  50 B          │ pkg/: 2 files, 0 selected, 7",
+		"\033[7m ▾ [ ] pkg/  700 B            \033[0m│   bundle/                   ",
+		" 1 files selected, 50 B, ~13 tokens                         ",
+		" space toggle  a all  →← expand  / search  tab preview  s sa",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("view with preview:\n%q\nwant:\n%q", got, want)
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	tests := []struct {
+		input string
+		want  []string
+	}{
+		{"abc", []string{"a", "b", "c"}},
+		{"\x1b[A\x1b[B\x1b[C\x1b[D", []string{"up", "down", "right", "left"}},
+		{"\x1bOA\x1bOH\x1bOF", []string{"up", "home", "end"}},
+		{"\x1b[5~\x1b[6~\x1b[1~\x1b[4~", []string{"pgup", "pgdown", "home", "end"}},
+		// Modified arrows keep their key, unknown sequences are dropped
+		{"\x1b[1;5A\x1b[2~x", []string{"up", "x"}},
+		{"\x1b", []string{"esc"}},
+		{"\x1bq", []string{"esc", "q"}},
+		{"\r\n\t\x7f\x08\x03", []string{"enter", "enter", "tab", "backspace", "backspace", "ctrl-c"}},
+		{"é→", []string{"é", "→"}},
+		// Other control characters and invalid UTF-8 are dropped
+		{"\x01a\xffb", []string{"a", "b"}},
+		// A sequence cut at the end of the input is dropped
+		{"a\x1b[1;", []string{"a"}},
+	}
+	for _, tt := range tests {
+		if got := parseKeys([]byte(tt.input)); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseKeys(%q) = %q, want %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestFuzzyScore(t *testing.T) {
+	tests := []struct {
+		query  string
+		target string
+		match  bool
+	}{
+		{"proc", "pkg/processor.go", true},
+		{"PROC", "pkg/processor.go", true},
+		{"pkgpr", "pkg/processor.go", true},
+		{"pgo", "pkg/processor.go", true},
+		{"rp", "pkg/processor.go", false},
+		{"xyz", "pkg/processor.go", false},
+		{"processorr", "pkg/processor.go", false},
+		{"", "main.go", true},
+	}
+	for _, tt := range tests {
+		if _, ok := fuzzyScore(tt.query, tt.target); ok != tt.match {
+			t.Errorf("fuzzyScore(%q, %q) matched = %v, want %v", tt.query, tt.target, ok, tt.match)
+		}
+	}
+
+	// Better matches score higher: consecutive letters, starts of
+	// components and the file name
+	better := []struct {
+		query, higher, lower string
+	}{
+		{"set", "cmd/set.go", "pkg/selection_test.go"},
+		{"root", "cmd/root.go", "docs/requirements_other.go"},
+		{"main", "main.go", "pkg/mail/index.go"},
+		{"conf", "pkg/config.go", "pkg/bundle/cond_if.go"},
+	}
+	for _, tt := range better {
+		high, _ := fuzzyScore(tt.query, tt.higher)
+		low, _ := fuzzyScore(tt.query, tt.lower)
+		if high <= low {
+			t.Errorf("fuzzyScore(%q): %s = %d, %s = %d, want the first higher", tt.query, tt.higher, high, tt.lower, low)
+		}
+	}
+}
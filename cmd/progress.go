@@ -0,0 +1,64 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/dakoctba/scopy/pkg"
+)
+
+// progressInterval is how often the progress line is redrawn. Runs shorter
+// than this never show it.
+const progressInterval = 200 * time.Millisecond
+
+// showProgress reports whether the progress is drawn on stderr
+func showProgress() bool {
+	switch opts.Progress {
+	case pkg.ProgressAlways:
+		return true
+	case pkg.ProgressNever:
+		return false
+	}
+	return !opts.Quiet && isTerminal(os.Stderr)
+}
+
+// progressReporter draws the progress on a single line, redrawn in place
+type progressReporter struct {
+	w     io.Writer
+	last  time.Time
+	drawn bool
+}
+
+func newProgressReporter(w io.Writer) *progressReporter {
+	return &progressReporter{w: w, last: time.Now()}
+}
+
+func (r *progressReporter) Progress(p pkg.Progress) {
+	// Clear the line for the statistics
+	if p.Done {
+		if r.drawn {
+			fmt.Fprint(r.w, "\r\033[K")
+		}
+		return
+	}
+	if time.Since(r.last) < progressInterval {
+		return
+	}
+	r.last = time.Now()
+	r.drawn = true
+
+	line := fmt.Sprintf("%d scanned, %d selected, %s", p.Scanned, p.Selected, pkg.HumanSize(p.Bytes))
+	switch {
+	case p.Estimating:
+		line = fmt.Sprintf("counting files: %d scanned", p.Scanned)
+	case p.TotalFiles > 0:
+		line = fmt.Sprintf("%d scanned, %d/%d files, %s/%s (%.0f%%)", p.Scanned, p.Selected, p.TotalFiles,
+			pkg.HumanSize(p.Bytes), pkg.HumanSize(p.TotalBytes), p.Fraction()*100)
+		if eta := p.ETA(); eta > 0 {
+			line += fmt.Sprintf(", ETA %s", eta.Round(time.Second))
+		}
+	}
+	fmt.Fprintf(r.w, "\r\033[K%s", line)
+}
@@ -1,14 +1,19 @@
 package cmd
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"io/fs"
 	"os"
-	"strconv"
+	"os/signal"
+	"path/filepath"
 	"strings"
+	"syscall"
 
-	"github.com/atotto/clipboard"
 	"github.com/dakoctba/scopy/pkg"
 	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
 )
 
 var (
@@ -18,18 +23,18 @@ var (
 	buildTime = "unknown"
 	gitCommit = "unknown"
 
-	// Flags
-	headerFormat    string
-	excludePatterns string
-	maxSize         string
-	stripComments   bool
-	includeDotFiles bool
-	followSymlinks  bool
+	// opts holds the options set by flags and configuration files
+	opts = pkg.DefaultOptions()
+
+	// Flags that select configuration files rather than options
+	configPath  string
+	noConfig    bool
+	profileName string
 )
 
 // rootCmd represents the base command
 var rootCmd = &cobra.Command{
-	Use:   "scopy [extensions...]",
+	Use:   "scopy [extensions...|files...]",
 	Short: "Smart Copy - Copy content from files with specific extensions",
 	Long: `Scopy is a command line tool that allows copying content
 from files with specific extensions intelligently, respecting
@@ -37,107 +42,257 @@ exclusion settings and custom formats.`,
 	Example: `  scopy go js                               # Copy .go and .js files
   scopy --header-format "/* %s */" go       # Customize header format
   scopy --exclude "vendor,dist" go js       # Ignore vendor and dist directories
+  scopy @web                                # Copy files of the "web" extension group
   scopy --max-size 500KB go                 # Ignore .go files larger than 500KB
   scopy --strip-comments go js              # Remove comments from copied files
+  scopy --outline go                        # Copy the API of the .go files, without bodies
   scopy --all go                            # Include dot files (hidden files)
-  scopy --follow go                         # Follow symbolic links`,
-	Args: cobra.MinimumNArgs(1),
+  scopy --follow go                         # Follow symbolic links
+  scopy --eol lf go                         # Normalize line endings to \n
+  scopy --archive release.tar.gz go         # Copy the .go files of an archive
+  scopy --rev v1.4.2 go                     # Copy the .go files as of a tag
+  scopy -o bundle.txt go                    # Write to a file instead of the clipboard
+  scopy -o bundle.txt.gz go                 # Write a gzip-compressed file
+  scopy --stdout go | less                  # Force output to stdout
+  scopy --pipe "wc -c" go                   # Stream the content to a command
+  scopy --list-only go                      # List the files that would be copied
+  scopy --list-rejected --list-details go   # Show sizes, tokens and why files were left out
+  scopy --stats-format json go 2>stats.json # Write machine-readable statistics
+  scopy -p review                           # Use the settings of the "review" profile
+  scopy pkg/processor.go:120-200            # Copy a range of lines of a file
+  scopy pkg/processor.go#processFile        # Copy a single function
+  scopy --from cmd/root.go --deps           # Copy a file and the local files it imports
+  scopy --from src/app.ts --deps --depth 1  # Copy a file and its direct imports only`,
+	Args: cobra.ArbitraryArgs,
+	// Errors are printed by Execute, which also picks the exit code
+	SilenceErrors: true,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		// Convert maximum size to bytes
-		var maxSizeBytes int64
-		if maxSize != "" {
-			var err error
-			maxSizeBytes, err = parseSize(maxSize)
+		// From here on errors are about the run, not about how scopy was called
+		cmd.SilenceUsage = true
+
+		// Files named as arguments are copied instead of a selection
+		var extensions []string
+		var named pkg.FileSet
+		for _, arg := range args {
+			if !pkg.IsFileArg(arg) {
+				extensions = append(extensions, arg)
+				continue
+			}
+			entry, err := pkg.ParseSetEntry(filepath.ToSlash(arg))
 			if err != nil {
-				return fmt.Errorf("error parsing maximum size: %v", err)
+				return pkg.NewError(pkg.KindUsage, err)
 			}
+			named.Files = append(named.Files, entry)
 		}
-
-		// Check if output is being redirected
-		isRedirected := false
-		if fileInfo, _ := os.Stdout.Stat(); (fileInfo.Mode() & os.ModeCharDevice) == 0 {
-			isRedirected = true
-		}
-
-		// Configure processor
-		config := pkg.Config{
-			HeaderFormat:    headerFormat,
-			ExcludePatterns: strings.Split(excludePatterns, ","),
-			MaxSize:         maxSizeBytes,
-			StripComments:   stripComments,
-			Extensions:      args,
-			OutputToMemory:  !isRedirected, // Store in memory if NOT redirected
-			IncludeDotFiles: includeDotFiles,
-			FollowSymlinks:  followSymlinks,
+		if len(named.Files) > 0 {
+			if len(extensions) > 0 {
+				return pkg.NewError(pkg.KindUsage, fmt.Errorf("conflicting arguments %s and %s: give either extensions or files",
+					strings.Join(extensions, " "), named.Files[0]))
+			}
+			if err := applyConfig(cmd, nil); err != nil {
+				return err
+			}
+			// --from may also come from a configuration file or SCOPY_FROM
+			if len(opts.From) > 0 {
+				return pkg.NewError(pkg.KindUsage, fmt.Errorf("conflicting argument %s and from %s: give either files or entry files",
+					named.Files[0], strings.Join(opts.From, ",")))
+			}
+			return runFiles("copying named files", func() ([]pkg.FileSpec, error) {
+				return named.Resolve(".")
+			})
 		}
 
-		processor := pkg.NewProcessor(config)
-		err := processor.Process(".")
-		if err != nil {
-			return fmt.Errorf("error processing files: %v", err)
+		if err := applyConfig(cmd, extensions); err != nil {
+			return err
 		}
 
-		// If not redirected, copy to clipboard
-		if !isRedirected {
-			output := processor.GetOutput()
-			if err := clipboard.WriteAll(output); err != nil {
-				fmt.Fprintf(os.Stderr, "Warning: could not copy to clipboard: %v\n", err)
-			} else {
-				fmt.Fprintln(os.Stderr, "Content copied to clipboard!")
+		// Entry files, with their imports, are copied instead of a selection
+		if len(opts.From) > 0 {
+			if len(args) > 0 {
+				return pkg.NewError(pkg.KindUsage, fmt.Errorf("conflicting arguments %s and --from: give either extensions or entry files",
+					strings.Join(args, " ")))
 			}
+			return runFiles("--from", resolveFrom)
 		}
-
-		// Display statistics to stderr
-		stats := processor.GetStats()
-		fmt.Fprintf(os.Stderr, "\n")
-		fmt.Fprintf(os.Stderr, "Total files: %d\n", stats.TotalFiles)
-		fmt.Fprintf(os.Stderr, "Files by extension:\n")
-		for ext, count := range stats.FilesByExt {
-			fmt.Fprintf(os.Stderr, "  %s: %d\n", ext, count)
+		if err := opts.Validate(); err != nil {
+			return err
 		}
-		fmt.Fprintf(os.Stderr, "Total bytes: %d\n", stats.TotalBytes)
-		fmt.Fprintf(os.Stderr, "Total lines: %d\n", stats.TotalLines)
 
-		// Show comment removal statistics if strip-comments was enabled
-		if stripComments && stats.CommentsRemoved > 0 {
-			fmt.Fprintf(os.Stderr, "Removed lines (comments): %d\n", stats.CommentsRemoved)
+		// Read the files from an archive or a git revision instead of the
+		// current directory
+		var source fs.FS
+		switch {
+		case opts.Archive != "":
+			fsys, closer, err := pkg.OpenArchive(opts.Archive)
+			if err != nil {
+				return pkg.NewError(pkg.KindIO, fmt.Errorf("error opening archive: %v", err))
+			}
+			defer closer.Close()
+			source = fsys
+		case opts.Rev != "":
+			fsys, err := pkg.OpenRevision(opts.Rev)
+			if err != nil {
+				return pkg.NewError(pkg.KindIO, fmt.Errorf("error reading revision: %w", err))
+			}
+			source = fsys
 		}
 
-		return nil
+		return runBundle(func(ctx context.Context, processor *pkg.Processor) error {
+			if source != nil {
+				return processor.ProcessFS(ctx, source)
+			}
+			return processor.ProcessContext(ctx, ".")
+		})
 	},
 }
 
-func parseSize(sizeStr string) (int64, error) {
-	sizeStr = strings.ToUpper(sizeStr)
-	var multiplier int64 = 1
+// prepareRun fills the options not given on the command line from
+// configuration files and checks them, before any file is read
+func prepareRun(cmd *cobra.Command, extensions []string) error {
+	if err := applyConfig(cmd, extensions); err != nil {
+		return err
+	}
+	return opts.Validate()
+}
+
+// runFileSet copies the files of set, relative to root, which are named, so
+// the options are checked without requiring extensions
+func runFileSet(cmd *cobra.Command, root string, set pkg.FileSet, command string) error {
+	if err := applyConfig(cmd, nil); err != nil {
+		return err
+	}
+	return runFiles(command, func() ([]pkg.FileSpec, error) {
+		return set.Resolve(root)
+	})
+}
 
-	if strings.HasSuffix(sizeStr, "KB") {
-		multiplier = 1024
-		sizeStr = strings.TrimSuffix(sizeStr, "KB")
-	} else if strings.HasSuffix(sizeStr, "MB") {
-		multiplier = 1024 * 1024
-		sizeStr = strings.TrimSuffix(sizeStr, "MB")
-	} else if strings.HasSuffix(sizeStr, "GB") {
-		multiplier = 1024 * 1024 * 1024
-		sizeStr = strings.TrimSuffix(sizeStr, "GB")
+// runFiles copies the files chosen by name by resolve, once the options
+// have been applied. Failures to resolve them are usage errors, like an
+// unknown symbol, unless resolve tells a read failure.
+func runFiles(command string, resolve func() ([]pkg.FileSpec, error)) error {
+	if err := opts.ValidateNamed(); err != nil {
+		return err
+	}
+	if err := checkWorkingTree(command); err != nil {
+		return err
 	}
 
-	size, err := strconv.ParseInt(sizeStr, 10, 64)
+	files, err := resolve()
 	if err != nil {
-		return 0, err
+		return pkg.NewError(pkg.KindUsage, err)
 	}
+	return runBundle(func(ctx context.Context, processor *pkg.Processor) error {
+		return processor.ProcessFiles(ctx, files)
+	})
+}
 
-	return size * multiplier, nil
+// resolveFrom returns the entry files of --from followed, with --deps, by the
+// local files they import
+func resolveFrom() ([]pkg.FileSpec, error) {
+	depth := 0
+	if opts.Deps {
+		depth = opts.Depth
+		if depth == 0 {
+			depth = -1
+		}
+	}
+	paths, err := pkg.Dependencies(opts.From, depth)
+	if err != nil {
+		return nil, err
+	}
+	files := make([]pkg.FileSpec, len(paths))
+	for i, path := range paths {
+		files[i] = pkg.FileSpec{Path: path}
+	}
+	return files, nil
 }
 
-func init() {
-	rootCmd.Flags().StringVarP(&headerFormat, "header-format", "f", "// file: %s", "Format of the header that precedes each file")
-	rootCmd.Flags().StringVarP(&excludePatterns, "exclude", "e", "", "Patterns to exclude files/directories (comma-separated)")
-	rootCmd.Flags().StringVarP(&maxSize, "max-size", "s", "", "Maximum size of files to be included")
-	rootCmd.Flags().BoolVarP(&stripComments, "strip-comments", "c", false, "Remove comments from code files")
+// checkWorkingTree rejects the sources other than the working tree, for the
+// commands copying files chosen by name
+func checkWorkingTree(command string) error {
+	if opts.Archive != "" || opts.Rev != "" {
+		return pkg.NewError(pkg.KindUsage, fmt.Errorf("%s reads the working tree: --archive and --rev can't be used", command))
+	}
+	return nil
+}
 
-	rootCmd.Flags().BoolVarP(&includeDotFiles, "all", "a", false, "Include files & directories beginning with a dot (.)")
-	rootCmd.Flags().BoolVarP(&followSymlinks, "follow", "F", false, "Follow symbolic links")
+// runBundle writes the files chosen by process to the selected output and
+// reports the statistics
+func runBundle(process func(ctx context.Context, processor *pkg.Processor) error) error {
+	output, err := openOutput()
+	if err != nil {
+		return pkg.NewError(pkg.KindIO, err)
+	}
+
+	// Ctrl-C and --timeout stop the run without delivering partial content
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if opts.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, opts.Timeout)
+		defer cancel()
+	}
+
+	// Configure processor
+	config := opts.ProcessorConfig()
+	config.Output = output
+	if showProgress() {
+		config.Progress = newProgressReporter(os.Stderr)
+	}
+
+	// Unreadable files don't stop the run: the content of the other files is
+	// delivered and the partial failure is reported after the statistics
+	processor := pkg.NewProcessor(config)
+	processErr := process(ctx, processor)
+	if err := processErr; err != nil && pkg.KindOf(err) != pkg.KindPartial {
+		output.Abort()
+		if pkg.KindOf(err) == pkg.KindCanceled {
+			if errors.Is(err, context.DeadlineExceeded) {
+				return pkg.NewError(pkg.KindCanceled, fmt.Errorf("timed out after %s; nothing was delivered", opts.Timeout))
+			}
+			return pkg.NewError(pkg.KindCanceled, errors.New("interrupted; nothing was delivered"))
+		}
+		var limitErr *pkg.OutputLimitError
+		if errors.As(err, &limitErr) {
+			return pkg.NewError(pkg.KindIO, fmt.Errorf("content is too large for the clipboard (limit %s); use --output, --stdout or --clipboard-limit", pkg.FormatSize(limitErr.Limit)))
+		}
+		if pkg.KindOf(err) == pkg.KindNothingMatched {
+			return err
+		}
+		return pkg.NewError(pkg.KindIO, fmt.Errorf("error processing files: %v", err))
+	}
+
+	// In list mode the listing takes the place of the content
+	if opts.ListMode() {
+		if err := writeListing(output, processor.GetEntries()); err != nil {
+			output.Abort()
+			return pkg.NewError(pkg.KindIO, err)
+		}
+	}
+
+	// Deliver the content to its destination
+	if err := output.Finish(); err != nil {
+		return pkg.NewError(pkg.KindIO, err)
+	}
+
+	// Display statistics to stderr
+	if !opts.Quiet {
+		if opts.StatsFormat == pkg.StatsFormatTable {
+			fmt.Fprintf(os.Stderr, "\n")
+		}
+		if err := pkg.WriteStats(os.Stderr, processor.GetStats(), opts.StatsFormat, opts.StatsTop); err != nil {
+			return pkg.NewError(pkg.KindIO, err)
+		}
+	}
+
+	return processErr
+}
+
+func init() {
+	addRunFlags(rootCmd)
+	rootCmd.Flags().StringSliceVar(&opts.From, "from", nil, "Copy these entry files instead of a selection (comma-separated)")
+	rootCmd.Flags().BoolVar(&opts.Deps, "deps", false, "With --from, also copy the local files the entry files import, transitively")
+	rootCmd.Flags().IntVar(&opts.Depth, "depth", 0, "With --deps, follow at most this many levels of imports (0 for no limit)")
 
 	rootCmd.Flags().BoolP("version", "v", false, "Show version number")
 
@@ -219,7 +374,62 @@ Use "{{.CommandPath}} [command] --help" for more information about a command.{{e
 // Execute adds all child commands to the root command and sets flags appropriately.
 func Execute() {
 	if err := rootCmd.Execute(); err != nil {
-		fmt.Fprintln(os.Stderr, err)
-		os.Exit(1)
+		fmt.Fprintln(os.Stderr, "Error:", err)
+		if pkg.KindOf(err) == pkg.KindUsage {
+			fmt.Fprintln(os.Stderr, "Run 'scopy --help' for usage.")
+		}
+		os.Exit(exitCode(err))
 	}
 }
+
+// addRunFlags defines the flags of the options of a copy on cmd
+func addRunFlags(cmd *cobra.Command) {
+	flags := cmd.Flags()
+	flags.StringVarP(&opts.HeaderFormat, "header-format", "f", opts.HeaderFormat, "Format of the header that precedes each file")
+	flags.StringSliceVarP(&opts.Exclude, "exclude", "e", nil, "Patterns to exclude files/directories (comma-separated)")
+	flags.VarP(&opts.MaxSize, "max-size", "s", "Maximum size of files to be included")
+	flags.BoolVarP(&opts.StripComments, "strip-comments", "c", false, "Remove comments from code files")
+	flags.BoolVar(&opts.Outline, "outline", false, "Copy declarations and signatures only, for supported languages")
+
+	flags.BoolVarP(&opts.All, "all", "a", false, "Include files & directories beginning with a dot (.)")
+	flags.BoolVarP(&opts.Follow, "follow", "F", false, "Follow symbolic links")
+	flags.StringVar(&opts.SymlinkPath, "symlink-path", opts.SymlinkPath, "Path in the header of files reached through symbolic links: link or target")
+	flags.BoolVar(&opts.StayInRoot, "stay-in-root", false, "Skip symbolic links leading outside the current directory")
+	flags.StringVar(&opts.Archive, "archive", "", "Read the files from a .zip, .tar, .tar.gz or .tgz archive instead of the current directory")
+	flags.StringVar(&opts.Rev, "rev", "", "Read the files as they are at a git commit, tag or branch, without checking it out")
+	cmd.MarkFlagsMutuallyExclusive("archive", "rev")
+	flags.StringVar(&opts.FallbackEncoding, "fallback-encoding", opts.FallbackEncoding, "Charset assumed for files that are neither UTF-8 nor UTF-16: windows-1252, latin1 or utf-8")
+	flags.StringVar(&opts.EOL, "eol", opts.EOL, "Line endings of the copied content: lf, crlf or preserve")
+
+	flags.StringVarP(&opts.Output, "output", "o", "", "Write the content to a file (compressed with gzip when it ends in .gz)")
+	flags.BoolVar(&opts.Stdout, "stdout", false, "Write the content to stdout even when it is a terminal")
+	flags.BoolVar(&opts.Clipboard, "clipboard", false, "Copy the content to the clipboard even when stdout is redirected")
+	flags.StringVar(&opts.Pipe, "pipe", "", "Stream the content to the standard input of a shell command")
+	flags.Var(&opts.ClipboardLimit, "clipboard-limit", "Maximum size of the content copied to the clipboard (0 for no limit)")
+	flags.StringVar(&opts.ClipboardBackend, "clipboard-backend", opts.ClipboardBackend, "Clipboard backend: "+strings.Join(clipboardBackendNames(), ", "))
+	cmd.MarkFlagsMutuallyExclusive(pkg.OutputKeys...)
+
+	flags.BoolVar(&opts.FailOnEmpty, "fail-on-empty", false, "Exit with code 5 when no file matches")
+	flags.BoolVar(&opts.Strict, "strict", false, "Stop at the first unreadable file instead of skipping it")
+	flags.DurationVar(&opts.Timeout, "timeout", 0, "Give up after this long, e.g. 30s or 2m (0 for no timeout)")
+	flags.StringVar(&opts.Progress, "progress", opts.Progress, "Show the progress on stderr: auto (when it is a terminal), always or never")
+
+	flags.BoolVarP(&opts.ListOnly, "list-only", "l", false, "List the files that would be copied instead of copying them (alias: --dry-run)")
+	flags.BoolVar(&opts.ListDetails, "list-details", false, "List each file with its bytes, lines and estimated tokens (implies --list-only)")
+	flags.BoolVar(&opts.ListRejected, "list-rejected", false, "Also list the files left out by a filter and why (implies --list-only)")
+	flags.SetNormalizeFunc(func(f *pflag.FlagSet, name string) pflag.NormalizedName {
+		if name == "dry-run" {
+			name = "list-only"
+		}
+		return pflag.NormalizedName(name)
+	})
+
+	flags.StringVar(&opts.StatsFormat, "stats-format", opts.StatsFormat, "Format of the statistics written to stderr: table or json")
+	flags.IntVar(&opts.StatsTop, "stats-top", opts.StatsTop, "Number of largest files listed in the statistics")
+	flags.BoolVarP(&opts.Quiet, "quiet", "q", false, "Don't write statistics to stderr")
+
+	flags.StringVarP(&profileName, "profile", "p", "", "Apply a named profile from the configuration files")
+	flags.StringVar(&configPath, "config", "", "Use this configuration file instead of searching for one")
+	flags.BoolVar(&noConfig, "no-config", false, "Ignore configuration files")
+	cmd.MarkFlagsMutuallyExclusive("config", "no-config")
+}
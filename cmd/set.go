@@ -0,0 +1,267 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/dakoctba/scopy/pkg"
+	"github.com/spf13/cobra"
+)
+
+// setDescription is the description given to a set with set save
+var setDescription string
+
+// setCmd groups the commands managing saved sets of files
+var setCmd = &cobra.Command{
+	Use:   "set",
+	Short: "Save and replay named sets of files",
+	Long: `Sets are curated lists of files saved in .scopy/sets/<name>.yaml of the
+project root: the nearest directory, from the current one upward, with a
+.scopy/sets directory or else a project configuration file. Entries are paths
+relative to the root, globs where ** matches any number of directories, or
+paths with a line range such as pkg/processor.go:120-200 or with symbols such
+as pkg/processor.go#processFile.
+Sets can be committed and replayed by anyone with identical output.`,
+	SilenceErrors: true,
+}
+
+var setSaveCmd = &cobra.Command{
+	Use:   "save <name> <file>...",
+	Short: "Save files, globs, line ranges and symbols as a named set",
+	Example: `  scopy set save api cmd/root.go 'pkg/**/*.go' # Save a file and a glob
+  scopy set save core pkg/processor.go:120-200 # Save a range of lines
+  scopy set save api -d "API layer" cmd/*.go   # Save with a description`,
+	Args:          cobra.MinimumNArgs(2),
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		name := args[0]
+		if err := pkg.ValidateSetName(name); err != nil {
+			return pkg.NewError(pkg.KindUsage, err)
+		}
+		root, err := setsRoot()
+		if err != nil {
+			return err
+		}
+		set := pkg.FileSet{Description: setDescription}
+		for _, arg := range args[1:] {
+			entry, err := pkg.ParseSetEntry(filepath.ToSlash(arg))
+			if err != nil {
+				return pkg.NewError(pkg.KindUsage, err)
+			}
+			if !entry.IsGlob() {
+				if err := checkSetFile(entry.Path); err != nil {
+					return pkg.NewError(pkg.KindUsage, err)
+				}
+			}
+			if entry.Path, err = rootPath(root, entry.Path); err != nil {
+				return pkg.NewError(pkg.KindUsage, err)
+			}
+			set.Files = append(set.Files, entry)
+		}
+
+		if err := pkg.SaveFileSet(root, name, set); err != nil {
+			return pkg.NewError(pkg.KindIO, fmt.Errorf("error saving set: %v", err))
+		}
+		fmt.Fprintf(os.Stderr, "Saved set %q to %s\n", name, pkg.SetPath(root, name))
+		return nil
+	},
+}
+
+var setListCmd = &cobra.Command{
+	Use:           "list",
+	Short:         "List the saved sets",
+	Args:          cobra.NoArgs,
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		root, err := setsRoot()
+		if err != nil {
+			return err
+		}
+		names, err := pkg.ListFileSets(root)
+		if err != nil {
+			return pkg.NewError(pkg.KindIO, err)
+		}
+		if len(names) == 0 {
+			fmt.Fprintf(os.Stderr, "No sets saved in %s\n", filepath.Join(root, pkg.SetsDir))
+			return nil
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(w, "NAME\tENTRIES\tDESCRIPTION")
+		for _, name := range names {
+			set, err := pkg.LoadFileSet(root, name)
+			if err != nil {
+				return pkg.NewError(pkg.KindConfig, err)
+			}
+			fmt.Fprintf(w, "%s\t%d\t%s\n", name, len(set.Files), set.Description)
+		}
+		return w.Flush()
+	},
+}
+
+var setShowCmd = &cobra.Command{
+	Use:           "show <name>",
+	Short:         "Show the entries of a set and the files they match",
+	Args:          cobra.ExactArgs(1),
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		root, set, err := loadSet(args[0])
+		if err != nil {
+			return err
+		}
+		if err := writeSet(os.Stdout, root, set); err != nil {
+			return pkg.NewError(pkg.KindIO, err)
+		}
+		return nil
+	},
+}
+
+var setRunCmd = &cobra.Command{
+	Use:   "run <name>",
+	Short: "Copy the files of a set",
+	Long: `Run copies the files of a set in the order of the set, like a normal run
+copies the selected files. The files are named, so extensions and the other
+selection filters don't apply; output and content options do.`,
+	Example: `  scopy set run api             # Copy the files of the set "api"
+  scopy set run api --stdout -c # Print them without comments`,
+	Args:          cobra.ExactArgs(1),
+	SilenceErrors: true,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cmd.SilenceUsage = true
+
+		root, set, err := loadSet(args[0])
+		if err != nil {
+			return err
+		}
+		return runFileSet(cmd, root, set, "set run")
+	},
+}
+
+// setsRoot returns the project root holding the sets, relative to the
+// current directory
+func setsRoot() (string, error) {
+	wd, err := os.Getwd()
+	if err != nil {
+		return "", pkg.NewError(pkg.KindIO, fmt.Errorf("error reading the current directory: %v", err))
+	}
+	root, err := pkg.FindSetsRoot(wd)
+	if err != nil {
+		return "", pkg.NewError(pkg.KindIO, err)
+	}
+	if rel, err := filepath.Rel(wd, root); err == nil {
+		root = rel
+	}
+	return root, nil
+}
+
+// rootPath makes name, a file or glob relative to the current directory,
+// relative to root, the directory the entries of a set are relative to
+func rootPath(root, name string) (string, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	abs, err := filepath.Abs(filepath.FromSlash(name))
+	if err != nil {
+		return "", err
+	}
+	rel, err := filepath.Rel(absRoot, abs)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", fmt.Errorf("%s is outside the project root %s", name, absRoot)
+	}
+	return filepath.ToSlash(rel), nil
+}
+
+// loadSet loads a saved set and returns it with the project root it is
+// relative to, with the error kind of a command line mistake when there is
+// no such set
+func loadSet(name string) (string, pkg.FileSet, error) {
+	if err := pkg.ValidateSetName(name); err != nil {
+		return "", pkg.FileSet{}, pkg.NewError(pkg.KindUsage, err)
+	}
+	root, err := setsRoot()
+	if err != nil {
+		return "", pkg.FileSet{}, err
+	}
+	set, err := pkg.LoadFileSet(root, name)
+	if err != nil {
+		if _, statErr := os.Stat(pkg.SetPath(root, name)); errors.Is(statErr, os.ErrNotExist) {
+			return root, set, pkg.NewError(pkg.KindUsage, fmt.Errorf("%v: see 'scopy set list'", err))
+		}
+		return root, set, pkg.NewError(pkg.KindConfig, err)
+	}
+	return root, set, nil
+}
+
+// checkSetFile checks that a file named in a set exists and is not a directory
+func checkSetFile(path string) error {
+	info, err := os.Stat(filepath.FromSlash(path))
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("%s is a directory: name its files or use a glob such as %s/**", path, path)
+	}
+	return nil
+}
+
+// writeSet prints the entries of a set relative to root, each glob followed
+// by the files it matches and each symbol by its lines, and marks the files
+// that don't exist
+func writeSet(w io.Writer, root string, set pkg.FileSet) error {
+	if set.Description != "" {
+		fmt.Fprintf(w, "%s\n\n", set.Description)
+	}
+	for _, entry := range set.Files {
+		if !entry.IsGlob() {
+			if err := checkSetFile(path.Join(filepath.ToSlash(root), entry.Path)); err != nil {
+				fmt.Fprintf(w, "%s (missing)\n", entry)
+				continue
+			}
+		}
+		if !entry.IsGlob() && entry.Symbol == "" {
+			fmt.Fprintln(w, entry)
+			continue
+		}
+
+		files, err := pkg.FileSet{Files: []pkg.SetEntry{entry}}.Resolve(root)
+		if err != nil {
+			fmt.Fprintf(w, "%s (%v)\n", entry, err)
+			continue
+		}
+		if entry.IsGlob() {
+			fmt.Fprintf(w, "%s (%d files)\n", entry, len(files))
+		} else {
+			fmt.Fprintln(w, entry)
+		}
+		// Matched files are shown relative to the root, like the entries
+		for _, file := range files {
+			if rel, err := filepath.Rel(root, file.Path); err == nil {
+				file.Path = rel
+			}
+			file.Path = filepath.ToSlash(file.Path)
+			fmt.Fprintf(w, "  %s\n", file)
+		}
+	}
+	return nil
+}
+
+func init() {
+	setSaveCmd.Flags().StringVarP(&setDescription, "description", "d", "", "Description of the set")
+	addRunFlags(setRunCmd)
+
+	setCmd.AddCommand(setSaveCmd, setListCmd, setShowCmd, setRunCmd)
+	rootCmd.AddCommand(setCmd)
+}
@@ -0,0 +1,214 @@
+package pkg
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// IsArchive reports whether name has the extension of an archive OpenArchive reads
+func IsArchive(name string) bool {
+	return archiveKind(name) != ""
+}
+
+func archiveKind(name string) string {
+	lower := strings.ToLower(name)
+	for _, ext := range []string{".zip", ".tar.gz", ".tgz", ".tar"} {
+		if strings.HasSuffix(lower, ext) {
+			return ext
+		}
+	}
+	return ""
+}
+
+// OpenArchive opens a .zip, .tar, .tar.gz or .tgz archive as a file system,
+// to be processed with ProcessFS. Only the regular files of tar archives are
+// kept, in memory. The closer releases the archive.
+func OpenArchive(name string) (fs.FS, io.Closer, error) {
+	switch archiveKind(name) {
+	case ".zip":
+		r, err := zip.OpenReader(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		return r, r, nil
+	case ".tar.gz", ".tgz", ".tar":
+		file, err := os.Open(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer file.Close()
+
+		var r io.Reader = file
+		if archiveKind(name) != ".tar" {
+			gz, err := gzip.NewReader(file)
+			if err != nil {
+				return nil, nil, fmt.Errorf("%s: %v", name, err)
+			}
+			defer gz.Close()
+			r = gz
+		}
+		fsys, err := readTar(r)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s: %v", name, err)
+		}
+		return fsys, nopCloser{}, nil
+	}
+	return nil, nil, fmt.Errorf("unsupported archive %q: expected a .zip, .tar, .tar.gz or .tgz file", name)
+}
+
+type nopCloser struct{}
+
+func (nopCloser) Close() error { return nil }
+
+// readTar loads the regular files of a tar stream
+func readTar(r io.Reader) (memFS, error) {
+	fsys := make(memFS)
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return fsys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		// Entries are often stored as "./dir/file"; entries escaping the
+		// archive root are dropped
+		name := path.Clean(strings.TrimPrefix(hdr.Name, "/"))
+		if !fs.ValidPath(name) || name == "." {
+			continue
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, err
+		}
+		fsys[name] = &memFile{data: data, size: int64(len(data)), mode: hdr.FileInfo().Mode(), modTime: hdr.ModTime}
+	}
+}
+
+// memFS is a read-only file system of regular files held in memory, keyed by
+// path. Directories are implied by the paths of their files.
+type memFS map[string]*memFile
+
+// memFile is the content of a memFS file, or the function loading it when
+// the file is opened
+type memFile struct {
+	data    []byte
+	load    func() ([]byte, error)
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (m memFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if file, ok := m[name]; ok {
+		data := file.data
+		if file.load != nil {
+			var err error
+			if data, err = file.load(); err != nil {
+				return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+			}
+		}
+		info := memInfo{name: path.Base(name), size: file.size, mode: file.mode, modTime: file.modTime}
+		return &openMemFile{Reader: bytes.NewReader(data), info: info}, nil
+	}
+
+	// A directory lists the first path element below it of every file
+	prefix := name + "/"
+	if name == "." {
+		prefix = ""
+	}
+	children := make(map[string]fs.DirEntry)
+	for filePath, file := range m {
+		rest, ok := strings.CutPrefix(filePath, prefix)
+		if !ok {
+			continue
+		}
+		child, _, isDir := strings.Cut(rest, "/")
+		if isDir {
+			children[child] = fs.FileInfoToDirEntry(memInfo{name: child, mode: fs.ModeDir | 0755})
+		} else {
+			children[child] = fs.FileInfoToDirEntry(memInfo{name: child, size: file.size, mode: file.mode, modTime: file.modTime})
+		}
+	}
+	if len(children) == 0 && name != "." {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+
+	entries := make([]fs.DirEntry, 0, len(children))
+	for _, entry := range children {
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return &memDir{info: memInfo{name: path.Base(name), mode: fs.ModeDir | 0755}, entries: entries}, nil
+}
+
+// memInfo describes a file or directory of a memFS
+type memInfo struct {
+	name    string
+	size    int64
+	mode    fs.FileMode
+	modTime time.Time
+}
+
+func (i memInfo) Name() string       { return i.name }
+func (i memInfo) Size() int64        { return i.size }
+func (i memInfo) Mode() fs.FileMode  { return i.mode }
+func (i memInfo) ModTime() time.Time { return i.modTime }
+func (i memInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i memInfo) Sys() interface{}   { return nil }
+
+type openMemFile struct {
+	*bytes.Reader
+	info memInfo
+}
+
+func (f *openMemFile) Stat() (fs.FileInfo, error) { return f.info, nil }
+func (f *openMemFile) Close() error               { return nil }
+
+type memDir struct {
+	info    memInfo
+	entries []fs.DirEntry
+	offset  int
+}
+
+func (d *memDir) Stat() (fs.FileInfo, error) { return d.info, nil }
+func (d *memDir) Close() error               { return nil }
+
+func (d *memDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: d.info.name, Err: fs.ErrInvalid}
+}
+
+// ReadDir follows the contract of fs.ReadDirFile
+func (d *memDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	rest := d.entries[d.offset:]
+	if n <= 0 {
+		d.offset = len(d.entries)
+		return rest, nil
+	}
+	if len(rest) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(rest) {
+		n = len(rest)
+	}
+	d.offset += n
+	return rest[:n], nil
+}
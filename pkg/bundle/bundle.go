@@ -0,0 +1,373 @@
+// Package bundle concatenates the source files of a directory tree into a
+// single text, each file preceded by a header naming it, as the scopy command
+// does. It is the supported way to use scopy from Go programs.
+//
+// Run bundles the files of any io/fs.FS and RunDir those of a directory of
+// the OS filesystem, where symbolic links can be followed as well. Files are
+// selected by extension and filtered as on the command line: dot files, the
+// .gitignore patterns of the root, exclude patterns and a size limit.
+//
+//	var buf bytes.Buffer
+//	res, err := bundle.Run(ctx, &buf, os.DirFS("."),
+//		bundle.WithExtensions("go", "@docs"),
+//		bundle.WithExclude("vendor"),
+//		bundle.WithStripComments(true),
+//	)
+//	if err != nil {
+//		return err
+//	}
+//	fmt.Printf("%d files, ~%d tokens\n", len(res.Files), res.Tokens)
+//
+// Hooks observe the files as they are processed:
+//
+//	res, err := bundle.RunDir(ctx, w, "src",
+//		bundle.WithExtensions("py"),
+//		bundle.WithFileHook(func(f bundle.File) error {
+//			log.Printf("%s: %d lines", f.Path, f.Lines)
+//			return nil
+//		}),
+//		bundle.WithSkipHook(func(s bundle.Skip) {
+//			log.Printf("skipped %s (%s: %s)", s.Path, s.Reason, s.Detail)
+//		}),
+//	)
+//
+// # Compatibility
+//
+// This package follows semantic versioning: within a major version, exported
+// identifiers are not removed or changed in incompatible ways, though new
+// options, constants and result fields may be added. The bundle format, a
+// header line per file followed by its content and a blank line between
+// files, is stable too. The other packages of this module are implementation
+// details of the command and may change in any release.
+package bundle
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"strings"
+	"time"
+
+	"github.com/dakoctba/scopy/pkg"
+)
+
+// Line ending modes accepted by WithEOL
+const (
+	EOLPreserve = pkg.EOLPreserve // Keep the line endings of each file
+	EOLLF       = pkg.EOLLF       // Convert every line ending to \n
+	EOLCRLF     = pkg.EOLCRLF     // Convert every line ending to \r\n
+)
+
+// SkipReason tells which filter left a file out
+type SkipReason string
+
+// Reasons for leaving a file out. Files without a requested extension are
+// not reported.
+const (
+	SkipDotFile     SkipReason = SkipReason(pkg.SkipDotFile)
+	SkipGitIgnore   SkipReason = SkipReason(pkg.SkipGitIgnore)
+	SkipExcluded    SkipReason = SkipReason(pkg.SkipExcluded)
+	SkipMaxSize     SkipReason = SkipReason(pkg.SkipMaxSize)
+	SkipDuplicate   SkipReason = SkipReason(pkg.SkipDuplicate)
+	SkipCycle       SkipReason = SkipReason(pkg.SkipCycle)
+	SkipOutsideRoot SkipReason = SkipReason(pkg.SkipOutsideRoot)
+)
+
+// File describes a file written to the bundle
+type File struct {
+	Path        string // Path in the header, relative to the root of the tree
+	Ext         string // Lowercase extension, with the dot
+	Size        int64  // Size of the file as read
+	InputLines  int    // Lines read from the file
+	Lines       int    // Lines of content written, after comment stripping
+	OutputBytes int64  // Bytes of content written, without the header
+	Tokens      int64  // Estimated language model tokens of the content written
+}
+
+// Skip describes a file with a requested extension that was left out
+type Skip struct {
+	Path   string
+	Size   int64
+	Reason SkipReason
+	Detail string // The pattern or limit behind Reason
+}
+
+// Result describes a bundle
+type Result struct {
+	Files   []File  // Files written, in order
+	Skipped []Skip  // Files with a requested extension left out by a filter
+	Errors  []error // Files that could not be read and were left out
+
+	InputBytes      int64 // Size of the files written
+	InputLines      int   // Lines of the files written
+	OutputBytes     int64 // Bytes written, headers and separators included
+	OutputLines     int   // Lines written, headers and separators included
+	Tokens          int64 // Estimated language model tokens of the content
+	CommentsRemoved int   // Comment lines dropped by WithStripComments
+	FilesTranscoded int   // Files converted to UTF-8 from another encoding
+	FilesOutlined   int   // Files replaced by their outline with WithOutline
+	Elapsed         time.Duration
+}
+
+// Progress describes how far a bundle is
+type Progress struct {
+	Path     string // The last file seen
+	Scanned  int    // Files seen, selected or not
+	Selected int    // Files written
+	Bytes    int64  // Size of the files written
+
+	// What the bundle will contain, from a scan made before writing it, which
+	// selects the files without reading them
+	TotalFiles int
+	TotalBytes int64
+
+	// Estimating is set while that scan runs: only Path and Scanned are known
+	Estimating bool
+
+	Elapsed time.Duration
+	Done    bool // Set on the last report, once the bundle is over
+}
+
+// ETA estimates the time left from the rate so far, or returns 0 when it
+// can't be estimated
+func (p Progress) ETA() time.Duration {
+	return pkg.Progress{
+		Selected:   p.Selected,
+		Bytes:      p.Bytes,
+		TotalFiles: p.TotalFiles,
+		TotalBytes: p.TotalBytes,
+		Elapsed:    p.Elapsed,
+		Done:       p.Done,
+	}.ETA()
+}
+
+// ProgressReporter is told about the progress of a bundle after each file.
+// It is called from the goroutine running the bundle.
+type ProgressReporter interface {
+	Progress(Progress)
+}
+
+// Option configures a bundle
+type Option func(*settings)
+
+type settings struct {
+	options  pkg.Options
+	onFile   func(File) error
+	onSkip   func(Skip)
+	progress ProgressReporter
+
+	outliners map[string]pkg.Outliner
+}
+
+// WithExtensions selects the files with these extensions, given with or
+// without the dot, or the extension groups named "@group" (such as "@web").
+// At least one extension is required.
+func WithExtensions(extensions ...string) Option {
+	return func(s *settings) { s.options.Extensions = append(s.options.Extensions, extensions...) }
+}
+
+// WithExclude leaves out the files whose path contains one of the patterns
+func WithExclude(patterns ...string) Option {
+	return func(s *settings) { s.options.Exclude = append(s.options.Exclude, patterns...) }
+}
+
+// WithMaxSize leaves out the files larger than size bytes (0 for no limit)
+func WithMaxSize(size int64) Option {
+	return func(s *settings) { s.options.MaxSize = pkg.Size(size) }
+}
+
+// WithHeaderFormat sets the header written before each file, where %s is
+// replaced by its path. The default is "// file: %s".
+func WithHeaderFormat(format string) Option {
+	return func(s *settings) { s.options.HeaderFormat = format }
+}
+
+// WithStripComments drops the lines that start with a comment
+func WithStripComments(strip bool) Option {
+	return func(s *settings) { s.options.StripComments = strip }
+}
+
+// WithOutline copies the outline of the files of languages with an
+// outliner: declarations, signatures and doc comments, without function
+// bodies. Files of other languages are copied whole.
+func WithOutline(outline bool) Option {
+	return func(s *settings) { s.options.Outline = outline }
+}
+
+// Outliner produces the outline of a file from its content for WithOutline.
+// An error means the content can't be outlined, and it is then copied whole.
+type Outliner interface {
+	Outline(src []byte) ([]byte, error)
+}
+
+// WithOutliner makes outliner the outliner of files with the given
+// extensions, like ".md", for this bundle only, before the registered ones
+func WithOutliner(outliner Outliner, extensions ...string) Option {
+	return func(s *settings) {
+		if s.outliners == nil {
+			s.outliners = map[string]pkg.Outliner{}
+		}
+		for _, ext := range extensions {
+			s.outliners[strings.ToLower(ext)] = outliner
+		}
+	}
+}
+
+// RegisterOutliner makes outliner the outliner of files with the given
+// extensions, like ".py", replacing the one registered before. The registry
+// is global: the outliner applies to every bundle of the process, so prefer
+// WithOutliner for a single one. Outliners for Go, Python,
+// TypeScript/JavaScript, Java, Rust and C headers are built in.
+func RegisterOutliner(outliner Outliner, extensions ...string) {
+	pkg.RegisterOutliner(outliner, extensions...)
+}
+
+// WithDotFiles includes the files and directories whose name starts with a dot
+func WithDotFiles(include bool) Option {
+	return func(s *settings) { s.options.All = include }
+}
+
+// WithFollowSymlinks enters the symbolic links to directories. It only
+// applies to RunDir.
+func WithFollowSymlinks(follow bool) Option {
+	return func(s *settings) { s.options.Follow = follow }
+}
+
+// WithEOL sets the line endings of the content: EOLPreserve (the default),
+// EOLLF or EOLCRLF
+func WithEOL(mode string) Option {
+	return func(s *settings) { s.options.EOL = mode }
+}
+
+// WithFallbackEncoding sets the charset assumed for files that are neither
+// UTF-8 nor UTF-16: "windows-1252" (the default), "latin1" or "utf-8"
+func WithFallbackEncoding(name string) Option {
+	return func(s *settings) { s.options.FallbackEncoding = name }
+}
+
+// WithStrict stops at the first file that can't be read, returning its error,
+// instead of leaving it out and reporting it in Result.Errors
+func WithStrict(strict bool) Option {
+	return func(s *settings) { s.options.Strict = strict }
+}
+
+// WithFileHook calls fn after each file is written. An error returned by fn
+// stops the bundle and is returned by Run.
+func WithFileHook(fn func(File) error) Option {
+	return func(s *settings) { s.onFile = fn }
+}
+
+// WithSkipHook calls fn for each file with a requested extension that a
+// filter leaves out
+func WithSkipHook(fn func(Skip)) Option {
+	return func(s *settings) { s.onSkip = fn }
+}
+
+// WithProgress reports the progress of the bundle to r
+func WithProgress(r ProgressReporter) Option {
+	return func(s *settings) { s.progress = r }
+}
+
+// Run writes to w the bundle of the files of fsys, from its root. The
+// headers show the paths of fsys. It returns the result so far with the error
+// when the bundle can't be completed, including when ctx is done.
+func Run(ctx context.Context, w io.Writer, fsys fs.FS, opts ...Option) (*Result, error) {
+	return run(w, opts, func(p *pkg.Processor) error {
+		return p.ProcessFS(ctx, fsys)
+	})
+}
+
+// RunDir writes to w the bundle of the files under the directory dir of the
+// OS filesystem, like Run. The headers show the paths joined to dir.
+// Canceling ctx stops both functions with an error wrapping ctx.Err().
+func RunDir(ctx context.Context, w io.Writer, dir string, opts ...Option) (*Result, error) {
+	return run(w, opts, func(p *pkg.Processor) error {
+		return p.ProcessContext(ctx, dir)
+	})
+}
+
+func run(w io.Writer, opts []Option, process func(*pkg.Processor) error) (*Result, error) {
+	s := settings{options: pkg.DefaultOptions()}
+	for _, opt := range opts {
+		opt(&s)
+	}
+	if len(s.options.Extensions) == 0 {
+		return nil, errors.New("bundle: no extensions given: use WithExtensions")
+	}
+	if err := s.options.Validate(); err != nil {
+		return nil, err
+	}
+	if w == nil {
+		w = io.Discard
+	}
+
+	res := &Result{}
+	config := s.options.ProcessorConfig()
+	config.Output = w
+	config.Outliners = s.outliners
+	config.OnFile = func(stat pkg.FileStat) error {
+		file := File{
+			Path:        stat.Path,
+			Ext:         stat.Ext,
+			Size:        stat.Bytes,
+			InputLines:  stat.InputLines,
+			Lines:       stat.Lines,
+			OutputBytes: stat.OutputBytes,
+			Tokens:      stat.Tokens,
+		}
+		res.Files = append(res.Files, file)
+		if s.onFile != nil {
+			return s.onFile(file)
+		}
+		return nil
+	}
+	config.OnSkip = func(entry pkg.Entry) {
+		skip := Skip{Path: entry.Path, Size: entry.Size, Reason: SkipReason(entry.Reason), Detail: entry.Detail}
+		res.Skipped = append(res.Skipped, skip)
+		if s.onSkip != nil {
+			s.onSkip(skip)
+		}
+	}
+
+	if s.progress != nil {
+		config.Progress = pkg.ProgressFunc(func(p pkg.Progress) {
+			s.progress.Progress(Progress{
+				Path:       p.Path,
+				Scanned:    p.Scanned,
+				Selected:   p.Selected,
+				Bytes:      p.Bytes,
+				TotalFiles: p.TotalFiles,
+				TotalBytes: p.TotalBytes,
+				Estimating: p.Estimating,
+				Elapsed:    p.Elapsed,
+				Done:       p.Done,
+			})
+		})
+	}
+
+	processor := pkg.NewProcessor(config)
+	err := process(processor)
+
+	stats := processor.GetStats()
+	for _, fileErr := range stats.Errors {
+		res.Errors = append(res.Errors, fileErr)
+	}
+	res.InputBytes = stats.InputBytes
+	res.InputLines = stats.InputLines
+	res.OutputBytes = stats.OutputBytes
+	res.OutputLines = stats.OutputLines
+	res.CommentsRemoved = stats.CommentsRemoved
+	res.FilesTranscoded = stats.FilesTranscoded
+	res.FilesOutlined = stats.FilesOutlined
+	res.Elapsed = stats.Elapsed
+	for _, file := range res.Files {
+		res.Tokens += file.Tokens
+	}
+
+	// Unreadable files are reported in the result, not as a failure
+	if pkg.KindOf(err) == pkg.KindPartial {
+		err = nil
+	}
+	return res, err
+}
@@ -0,0 +1,142 @@
+package bundle_test
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing/fstest"
+
+	"github.com/dakoctba/scopy/pkg/bundle"
+)
+
+func ExampleRun() {
+	fsys := fstest.MapFS{
+		"main.go":        {Data: []byte("package main\n\n// main starts the program\nfunc main() {}\n")},
+		"config.json":    {Data: []byte("{\"debug\": true}\n")},
+		"vendor/dep.go":  {Data: []byte("package dep\n")},
+		"notes/todo.txt": {Data: []byte("not selected\n")},
+	}
+
+	var buf bytes.Buffer
+	res, err := bundle.Run(context.Background(), &buf, fsys,
+		bundle.WithExtensions("go", "json"),
+		bundle.WithExclude("vendor"),
+		bundle.WithStripComments(true),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Print(buf.String())
+	fmt.Printf("---\n%d files, %d comment line(s) removed\n", len(res.Files), res.CommentsRemoved)
+	// Output:
+	// // file: config.json
+	// {"debug": true}
+	//
+	// // file: main.go
+	// package main
+	//
+	// func main() {}
+	// ---
+	// 2 files, 1 comment line(s) removed
+}
+
+func ExampleRunDir() {
+	dir, err := os.MkdirTemp("", "bundle")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(dir)
+	os.WriteFile(filepath.Join(dir, "app.py"), []byte("def run():\n    pass\n"), 0o644)
+	os.WriteFile(filepath.Join(dir, "big.py"), []byte(strings.Repeat("x = 1\n", 100)), 0o644)
+
+	var buf bytes.Buffer
+	_, err = bundle.RunDir(context.Background(), &buf, dir,
+		bundle.WithExtensions("py"),
+		bundle.WithMaxSize(100),
+		bundle.WithFileHook(func(f bundle.File) error {
+			fmt.Printf("copied %s: %d lines\n", filepath.Base(f.Path), f.Lines)
+			return nil
+		}),
+		bundle.WithSkipHook(func(s bundle.Skip) {
+			fmt.Printf("skipped %s (%s: %s)\n", filepath.Base(s.Path), s.Reason, s.Detail)
+		}),
+	)
+	if err != nil {
+		fmt.Println(err)
+	}
+	// Output:
+	// copied app.py: 2 lines
+	// skipped big.py (max-size: 600 bytes > 100 bytes)
+}
+
+func ExampleWithOutline() {
+	fsys := fstest.MapFS{
+		"greet.go": {Data: []byte(`package greet
+
+// Hello returns a greeting for name
+func Hello(name string) string {
+	return "Hello, " + name
+}
+
+func helper() {}
+`)},
+	}
+
+	var buf bytes.Buffer
+	res, err := bundle.Run(context.Background(), &buf, fsys,
+		bundle.WithExtensions("go"),
+		bundle.WithOutline(true),
+	)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Print(buf.String())
+	fmt.Printf("---\n%d file(s) outlined\n", res.FilesOutlined)
+	// Output:
+	// // file: greet.go
+	// package greet
+	//
+	// // Hello returns a greeting for name
+	// func Hello(name string) string
+	// ---
+	// 1 file(s) outlined
+}
+
+// headings outlines Markdown files as their headings
+type headings struct{}
+
+func (headings) Outline(src []byte) ([]byte, error) {
+	var out []string
+	for _, line := range strings.Split(string(src), "\n") {
+		if strings.HasPrefix(line, "#") {
+			out = append(out, line)
+		}
+	}
+	return []byte(strings.Join(out, "\n") + "\n"), nil
+}
+
+func ExampleWithOutliner() {
+	fsys := fstest.MapFS{
+		"guide.md": {Data: []byte("# Guide\n\nSome text.\n\n## Install\n\nMore text.\n")},
+	}
+	var buf bytes.Buffer
+	if _, err := bundle.Run(context.Background(), &buf, fsys,
+		bundle.WithExtensions("md"),
+		bundle.WithOutline(true),
+		bundle.WithOutliner(headings{}, ".md"),
+	); err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Print(buf.String())
+	// Output:
+	// // file: guide.md
+	// # Guide
+	// ## Install
+}
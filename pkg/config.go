@@ -1,64 +1,438 @@
 package pkg
 
 import (
-	"flag"
 	"fmt"
-	"os"
-	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
 	"strings"
+	"time"
 )
 
-// AppConfig represents the program configuration
-type AppConfig struct {
-	InputFile    string
-	OutputFile   string
-	HeaderFormat string
-	ShowHelp     bool
-	ShowVersion  bool
-	Version      string
-	BuildTime    string
-	GitCommit    string
-}
-
-// ParseFlags parses command line arguments
-func (c *AppConfig) ParseFlags() {
-	flag.StringVar(&c.InputFile, "i", "", "Input file path")
-	flag.StringVar(&c.OutputFile, "o", "", "Output file path")
-	flag.StringVar(&c.HeaderFormat, "f", "file: %s", "Header format (default: 'file: %s')")
-	flag.BoolVar(&c.ShowHelp, "h", false, "Show help")
-	flag.BoolVar(&c.ShowVersion, "v", false, "Show version")
-	flag.Parse()
-}
-
-// Validate validates the configuration
-func (c *AppConfig) Validate() error {
-	if c.ShowHelp || c.ShowVersion {
-		return nil
+// Options is the configuration model shared by the command line flags and the
+// configuration files. Each field's key (its yaml tag) is also the name of the
+// flag that sets it, so a value can come from any source under the same name.
+type Options struct {
+	Extensions       []string `yaml:"extensions" toml:"extensions"`
+	Exclude          []string `yaml:"exclude" toml:"exclude"`
+	MaxSize          Size     `yaml:"max-size" toml:"max-size"`
+	HeaderFormat     string   `yaml:"header-format" toml:"header-format"`
+	StripComments    bool     `yaml:"strip-comments" toml:"strip-comments"`
+	Outline          bool     `yaml:"outline" toml:"outline"`
+	All              bool     `yaml:"all" toml:"all"`
+	Follow           bool     `yaml:"follow" toml:"follow"`
+	SymlinkPath      string   `yaml:"symlink-path" toml:"symlink-path"`
+	StayInRoot       bool     `yaml:"stay-in-root" toml:"stay-in-root"`
+	EOL              string   `yaml:"eol" toml:"eol"`
+	FallbackEncoding string   `yaml:"fallback-encoding" toml:"fallback-encoding"`
+	Archive          string   `yaml:"archive" toml:"archive"`
+	Rev              string   `yaml:"rev" toml:"rev"`
+
+	// Entry files copied instead of a selection, with the local files they
+	// import when Deps is set, up to Depth levels (0 for no limit)
+	From  []string `yaml:"from" toml:"from"`
+	Deps  bool     `yaml:"deps" toml:"deps"`
+	Depth int      `yaml:"depth" toml:"depth"`
+
+	// Output destination: at most one of these can be set
+	Output    string `yaml:"output" toml:"output"`
+	Stdout    bool   `yaml:"stdout" toml:"stdout"`
+	Clipboard bool   `yaml:"clipboard" toml:"clipboard"`
+	Pipe      string `yaml:"pipe" toml:"pipe"`
+
+	ClipboardBackend string `yaml:"clipboard-backend" toml:"clipboard-backend"`
+	ClipboardLimit   Size   `yaml:"clipboard-limit" toml:"clipboard-limit"`
+
+	FailOnEmpty bool          `yaml:"fail-on-empty" toml:"fail-on-empty"`
+	Strict      bool          `yaml:"strict" toml:"strict"`
+	Timeout     time.Duration `yaml:"timeout" toml:"timeout"`
+	Progress    string        `yaml:"progress" toml:"progress"`
+
+	// List mode: print the selection instead of copying the content
+	ListOnly     bool `yaml:"list-only" toml:"list-only"`
+	ListDetails  bool `yaml:"list-details" toml:"list-details"`
+	ListRejected bool `yaml:"list-rejected" toml:"list-rejected"`
+
+	// Statistics written to stderr after the run
+	StatsFormat string `yaml:"stats-format" toml:"stats-format"`
+	StatsTop    int    `yaml:"stats-top" toml:"stats-top"`
+	Quiet       bool   `yaml:"quiet" toml:"quiet"`
+}
+
+// DefaultOptions returns the options used when nothing else is configured
+func DefaultOptions() Options {
+	return Options{
+		HeaderFormat:     "// file: %s",
+		EOL:              EOLPreserve,
+		SymlinkPath:      SymlinkPathLink,
+		FallbackEncoding: DefaultFallbackEncoding,
+		ClipboardBackend: "auto",
+		ClipboardLimit:   32 * 1024 * 1024,
+		Progress:         ProgressAuto,
+		StatsFormat:      StatsFormatTable,
+		StatsTop:         DefaultStatsTop,
+	}
+}
+
+// Progress modes: show the progress when stderr is a terminal, always or never
+const (
+	ProgressAuto   = "auto"
+	ProgressAlways = "always"
+	ProgressNever  = "never"
+)
+
+// OutputKeys are the options choosing the output destination
+var OutputKeys = []string{"output", "stdout", "clipboard", "pipe"}
+
+// Validate checks the options before any file is read. The errors name the
+// offending option, explain what is expected and are of kind KindUsage.
+func (o *Options) Validate() error {
+	if len(o.Extensions) == 0 {
+		return NewError(KindUsage, fmt.Errorf("no extensions given: pass them as arguments or set extensions in a configuration file or profile"))
+	}
+	return NewError(KindUsage, o.validate())
+}
+
+// ValidateNamed is Validate for runs copying files chosen by name, which
+// need no extensions
+func (o *Options) ValidateNamed() error {
+	return NewError(KindUsage, o.validate())
+}
+
+func (o *Options) validate() error {
+	if _, err := ExpandExtensions(o.Extensions); err != nil {
+		return err
+	}
+	if err := ValidateHeaderFormat(o.HeaderFormat); err != nil {
+		return err
+	}
+	if o.MaxSize < 0 {
+		return fmt.Errorf("invalid max-size %d: the size can't be negative", o.MaxSize)
+	}
+	if o.ClipboardLimit < 0 {
+		return fmt.Errorf("invalid clipboard-limit %d: the size can't be negative (use 0 for no limit)", o.ClipboardLimit)
+	}
+	if err := ValidateEOL(o.EOL); err != nil {
+		return err
+	}
+	if _, err := ParseFallbackEncoding(o.FallbackEncoding); err != nil {
+		return err
+	}
+	if o.Archive != "" && !IsArchive(o.Archive) {
+		return fmt.Errorf("invalid archive %q: expected a .zip, .tar, .tar.gz or .tgz file", o.Archive)
+	}
+	if o.Archive != "" && o.Rev != "" {
+		return fmt.Errorf("conflicting options --archive and --rev: choose a single source")
+	}
+	if err := ValidateSymlinkPath(o.SymlinkPath); err != nil {
+		return err
+	}
+	if err := ValidateStatsFormat(o.StatsFormat); err != nil {
+		return err
+	}
+	if o.Timeout < 0 {
+		return fmt.Errorf("invalid timeout %s: the duration can't be negative (use 0 for no timeout)", o.Timeout)
+	}
+	switch o.Progress {
+	case ProgressAuto, ProgressAlways, ProgressNever:
+	default:
+		return fmt.Errorf("invalid progress %q: expected %s, %s or %s", o.Progress, ProgressAuto, ProgressAlways, ProgressNever)
+	}
+	if o.Deps && len(o.From) == 0 {
+		return fmt.Errorf("--deps needs the entry files given with --from")
+	}
+	if o.Depth < 0 {
+		return fmt.Errorf("invalid depth %d: the number of import levels can't be negative (use 0 for no limit)", o.Depth)
+	}
+	if o.Depth > 0 && !o.Deps {
+		return fmt.Errorf("--depth limits the imports followed by --deps, which is not set")
+	}
+	if o.StatsTop < 0 {
+		return fmt.Errorf("invalid stats-top %d: the number of files can't be negative", o.StatsTop)
+	}
+
+	var destinations []string
+	for _, key := range OutputKeys {
+		if !reflect.ValueOf(o).Elem().FieldByIndex(optionField(key).Index).IsZero() {
+			destinations = append(destinations, "--"+key)
+		}
+	}
+	if len(destinations) > 1 {
+		return fmt.Errorf("conflicting options %s: choose a single output destination", strings.Join(destinations, " and "))
+	}
+
+	return nil
+}
+
+// ListMode reports whether the selection is listed instead of copied.
+// Asking for details or rejected files implies list mode.
+func (o *Options) ListMode() bool {
+	return o.ListOnly || o.ListDetails || o.ListRejected
+}
+
+// ProcessorConfig builds the Processor configuration for valid options
+func (o *Options) ProcessorConfig() Config {
+	extensions, _ := ExpandExtensions(o.Extensions)
+	encoding, _ := ParseFallbackEncoding(o.FallbackEncoding)
+	return Config{
+		HeaderFormat:     o.HeaderFormat,
+		HeaderPrefix:     headerPrefix(o.Rev),
+		ExcludePatterns:  o.Exclude,
+		MaxSize:          int64(o.MaxSize),
+		StripComments:    o.StripComments,
+		Outline:          o.Outline,
+		Extensions:       extensions,
+		OutputPath:       o.Output,
+		IncludeDotFiles:  o.All,
+		FollowSymlinks:   o.Follow,
+		SymlinkPath:      o.SymlinkPath,
+		StayInRoot:       o.StayInRoot,
+		EOL:              o.EOL,
+		FallbackEncoding: encoding,
+		FailOnEmpty:      o.FailOnEmpty,
+		Strict:           o.Strict,
+		ListOnly:         o.ListMode(),
+		ListDetails:      o.ListDetails,
+		ListRejected:     o.ListRejected,
+	}
+}
+
+// headerPrefix annotates the paths in headers with the revision they are
+// read at, as in "v1.4.2:cmd/root.go"
+func headerPrefix(rev string) string {
+	if rev == "" {
+		return ""
+	}
+	return rev + ":"
+}
+
+// ValidateHeaderFormat checks that format has exactly one %s verb, where the
+// file path goes, and no other verbs besides the %% escape
+func ValidateHeaderFormat(format string) error {
+	paths := 0
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			continue
+		}
+		if i+1 == len(format) {
+			return fmt.Errorf("invalid header format %q: it ends with a lone %%; write %%%% for a literal percent sign", format)
+		}
+		i++
+		switch format[i] {
+		case '%':
+		case 's':
+			paths++
+		default:
+			return fmt.Errorf("invalid header format %q: only %%s (the file path) and %%%% are allowed, found %%%c", format, format[i])
+		}
+	}
+	if paths != 1 {
+		return fmt.Errorf("invalid header format %q: it must contain %%s exactly once, where the file path goes", format)
+	}
+	return nil
+}
+
+// ExtensionGroups are named sets of extensions, selected with "@name"
+var ExtensionGroups = map[string][]string{
+	"c":      {"c", "h", "cc", "cpp", "cxx", "hh", "hpp"},
+	"config": {"json", "yaml", "yml", "toml", "ini", "xml"},
+	"docs":   {"md", "markdown", "rst", "adoc", "txt"},
+	"go":     {"go", "mod"},
+	"java":   {"java", "kt", "kts", "gradle"},
+	"js":     {"js", "jsx", "mjs", "cjs", "ts", "tsx"},
+	"python": {"py", "pyi"},
+	"rust":   {"rs"},
+	"shell":  {"sh", "bash", "zsh", "fish"},
+	"web":    {"html", "htm", "css", "scss", "js", "jsx", "ts", "tsx", "vue", "svelte"},
+}
+
+// ExpandExtensions replaces extension groups ("@web") by their extensions
+// and rejects unknown groups and malformed extensions
+func ExpandExtensions(list []string) ([]string, error) {
+	var expanded []string
+	seen := make(map[string]bool)
+	add := func(ext string) {
+		ext = strings.ToLower(strings.TrimPrefix(ext, "."))
+		if !seen[ext] {
+			seen[ext] = true
+			expanded = append(expanded, ext)
+		}
+	}
+
+	for _, item := range list {
+		item = strings.TrimSpace(item)
+		if name, ok := strings.CutPrefix(item, "@"); ok {
+			group, ok := ExtensionGroups[name]
+			if !ok {
+				return nil, fmt.Errorf("unknown extension group %q (available: %s)", item, strings.Join(extensionGroupNames(), ", "))
+			}
+			for _, ext := range group {
+				add(ext)
+			}
+			continue
+		}
+
+		if strings.TrimPrefix(item, ".") == "" || strings.ContainsAny(item, `/\*?`) {
+			return nil, fmt.Errorf("invalid extension %q: give extensions without path or wildcards, like \"go\" or \".go\"", item)
+		}
+		add(item)
+	}
+	return expanded, nil
+}
+
+func extensionGroupNames() []string {
+	names := make([]string, 0, len(ExtensionGroups))
+	for name := range ExtensionGroups {
+		names = append(names, "@"+name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OptionKeys returns the key of every option in declaration order
+func OptionKeys() []string {
+	t := reflect.TypeOf(Options{})
+	keys := make([]string, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		keys = append(keys, t.Field(i).Tag.Get("yaml"))
+	}
+	return keys
+}
+
+// CopyOption copies the option named key from src
+func (o *Options) CopyOption(src *Options, key string) {
+	field := optionField(key)
+	reflect.ValueOf(o).Elem().FieldByIndex(field.Index).Set(reflect.ValueOf(src).Elem().FieldByIndex(field.Index))
+}
+
+// SetOption parses value and assigns it to the option named key. Lists are
+// comma-separated and booleans accept the forms of strconv.ParseBool.
+func (o *Options) SetOption(key, value string) error {
+	field, ok := lookupOptionField(key)
+	if !ok {
+		return fmt.Errorf("unknown option %q", key)
 	}
 
-	if c.InputFile == "" {
-		return fmt.Errorf("input file is required")
+	target := reflect.ValueOf(o).Elem().FieldByIndex(field.Index)
+	switch ptr := target.Addr().Interface().(type) {
+	case *Size:
+		return ptr.Set(value)
+	case *string:
+		*ptr = value
+	case *time.Duration:
+		d, err := time.ParseDuration(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: expected a number with a unit, like 30s or 2m", value)
+		}
+		*ptr = d
+	case *int:
+		n, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		*ptr = n
+	case *bool:
+		b, err := strconv.ParseBool(strings.TrimSpace(value))
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q: expected true or false", value)
+		}
+		*ptr = b
+	case *[]string:
+		*ptr = nil
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				*ptr = append(*ptr, item)
+			}
+		}
+	}
+	return nil
+}
+
+// lookupOptionField returns the struct field of the option named key
+func lookupOptionField(key string) (reflect.StructField, bool) {
+	t := reflect.TypeOf(Options{})
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).Tag.Get("yaml") == key {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// optionField returns the struct field of the option named key
+func optionField(key string) reflect.StructField {
+	field, ok := lookupOptionField(key)
+	if !ok {
+		panic("unknown option " + key)
+	}
+	return field
+}
+
+// Size is a number of bytes written with an optional KB, MB or GB suffix.
+// It implements pflag.Value and the text and TOML unmarshalers, so sizes are
+// parsed the same way from flags and configuration files.
+type Size int64
+
+// ParseSize parses a size such as "500KB", "1MB" or "1024"
+func ParseSize(value string) (Size, error) {
+	sizeStr := strings.ToUpper(strings.TrimSpace(value))
+	var multiplier int64 = 1
+
+	if strings.HasSuffix(sizeStr, "KB") {
+		multiplier = 1024
+		sizeStr = strings.TrimSuffix(sizeStr, "KB")
+	} else if strings.HasSuffix(sizeStr, "MB") {
+		multiplier = 1024 * 1024
+		sizeStr = strings.TrimSuffix(sizeStr, "MB")
+	} else if strings.HasSuffix(sizeStr, "GB") {
+		multiplier = 1024 * 1024 * 1024
+		sizeStr = strings.TrimSuffix(sizeStr, "GB")
 	}
 
-	if c.OutputFile == "" {
-		// If not specified, use the same name as input file with .txt extension
-		ext := filepath.Ext(c.InputFile)
-		base := strings.TrimSuffix(c.InputFile, ext)
-		c.OutputFile = base + ".txt"
+	size, err := strconv.ParseInt(strings.TrimSpace(sizeStr), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid size %q: expected a number with an optional KB, MB or GB suffix", value)
 	}
 
+	return Size(size * multiplier), nil
+}
+
+// String formats the size with the largest exact unit
+func (s *Size) String() string {
+	if *s <= 0 {
+		return strconv.FormatInt(int64(*s), 10)
+	}
+	return strings.TrimSuffix(FormatSize(int64(*s)), " bytes")
+}
+
+// Set parses a size given on the command line
+func (s *Size) Set(value string) error {
+	size, err := ParseSize(value)
+	if err != nil {
+		return err
+	}
+	*s = size
 	return nil
 }
 
-// PrintUsage displays the help message
-func (c *AppConfig) PrintUsage() {
-	fmt.Printf("Usage: %s [options]\n\n", os.Args[0])
-	fmt.Println("Options:")
-	fmt.Println("  -i <file>    Input file path")
-	fmt.Println("  -o <file>    Output file path (optional)")
-	fmt.Printf("  -f <format>  Header format (default: 'file: %%s')\n")
-	fmt.Println("  -h           Show this help message")
-	fmt.Println("  -v           Show version information")
-	fmt.Println("\nExample:")
-	fmt.Printf("  %s -i input.txt -o output.txt -f 'file: %%s'\n", os.Args[0])
+// Type names the flag value type in the help output
+func (s *Size) Type() string {
+	return "size"
+}
+
+// UnmarshalText parses a size from a configuration file
+func (s *Size) UnmarshalText(text []byte) error {
+	return s.Set(string(text))
+}
+
+// UnmarshalTOML accepts both numbers and strings in TOML files
+func (s *Size) UnmarshalTOML(value interface{}) error {
+	switch v := value.(type) {
+	case int64:
+		*s = Size(v)
+		return nil
+	case string:
+		return s.Set(v)
+	}
+	return fmt.Errorf("invalid size %v: expected a number or a string like \"500KB\"", value)
 }
@@ -0,0 +1,371 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// ProjectConfigNames are the configuration file names searched from the
+// working directory upward, in order of preference
+var ProjectConfigNames = []string{".scopy.yaml", ".scopy.yml", ".scopy.toml"}
+
+// userConfigNames are the configuration file names searched in the user
+// configuration directory
+var userConfigNames = []string{"config.yaml", "config.yml", "config.toml", "config"}
+
+// ConfigFile is a configuration file: options applied on top of the
+// defaults plus named profiles that are applied on top of them
+type ConfigFile struct {
+	Path     string
+	apply    func(*Options) error
+	profiles map[string]func(*Options) error
+
+	// Line of each option set by the file, and by each of its profiles
+	lines        map[string]int
+	profileLines map[string]map[string]int
+}
+
+// yamlConfigFile is the layout of a YAML configuration file
+type yamlConfigFile struct {
+	Options  `yaml:",inline"`
+	Profiles map[string]yaml.Node `yaml:"profiles"`
+}
+
+// tomlConfigFile is the layout of a TOML configuration file
+type tomlConfigFile struct {
+	Options
+	Profiles map[string]toml.Primitive `toml:"profiles"`
+}
+
+// LoadConfigFile reads a YAML or TOML configuration file. Files ending in
+// .toml are parsed as TOML, everything else as YAML. Unknown keys, in the file
+// or in any of its profiles, are errors.
+func LoadConfigFile(path string) (*ConfigFile, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cfg *ConfigFile
+	if strings.EqualFold(filepath.Ext(path), ".toml") {
+		cfg, err = parseTOMLConfig(data)
+	} else {
+		cfg, err = parseYAMLConfig(data)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	cfg.Path = path
+
+	// Decode every profile once so mistakes show up even in unused profiles
+	for name, apply := range cfg.profiles {
+		var scratch Options
+		if err := apply(&scratch); err != nil {
+			return nil, fmt.Errorf("error parsing %s: profile %q: %v", path, name, err)
+		}
+	}
+	return cfg, nil
+}
+
+func parseYAMLConfig(data []byte) (*ConfigFile, error) {
+	decode := func(data []byte, out interface{}) error {
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		if err := decoder.Decode(out); err != nil && !errors.Is(err, io.EOF) {
+			return err
+		}
+		return nil
+	}
+
+	var file yamlConfigFile
+	if err := decode(data, &file); err != nil {
+		return nil, err
+	}
+
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	cfg := &ConfigFile{
+		profileLines: make(map[string]map[string]int),
+		apply: func(opts *Options) error {
+			layered := yamlConfigFile{Options: *opts}
+			if err := decode(data, &layered); err != nil {
+				return err
+			}
+			*opts = layered.Options
+			return nil
+		},
+		profiles: make(map[string]func(*Options) error),
+	}
+	if len(doc.Content) > 0 {
+		cfg.lines = yamlKeyLines(doc.Content[0])
+	}
+	for name, node := range file.Profiles {
+		cfg.profileLines[name] = yamlKeyLines(&node)
+		profile, err := yaml.Marshal(&node)
+		if err != nil {
+			return nil, err
+		}
+		cfg.profiles[name] = func(opts *Options) error {
+			return decode(profile, opts)
+		}
+	}
+	return cfg, nil
+}
+
+func parseTOMLConfig(data []byte) (*ConfigFile, error) {
+	var file tomlConfigFile
+	meta, err := toml.Decode(string(data), &file)
+	if err != nil {
+		return nil, err
+	}
+
+	cfg := &ConfigFile{
+		apply: func(opts *Options) error {
+			layered := tomlConfigFile{Options: *opts}
+			if _, err := toml.Decode(string(data), &layered); err != nil {
+				return err
+			}
+			*opts = layered.Options
+			return nil
+		},
+		profiles: make(map[string]func(*Options) error),
+	}
+	for name, primitive := range file.Profiles {
+		primitive := primitive
+		cfg.profiles[name] = func(opts *Options) error {
+			return meta.PrimitiveDecode(primitive, opts)
+		}
+		var scratch Options
+		if err := meta.PrimitiveDecode(primitive, &scratch); err != nil {
+			return nil, err
+		}
+	}
+	if undecoded := meta.Undecoded(); len(undecoded) > 0 {
+		return nil, fmt.Errorf("unknown key %q", undecoded[0].String())
+	}
+	cfg.lines, cfg.profileLines = tomlKeyLines(data)
+	return cfg, nil
+}
+
+// yamlKeyLines returns the line of each key of a YAML mapping
+func yamlKeyLines(node *yaml.Node) map[string]int {
+	lines := make(map[string]int)
+	if node.Kind != yaml.MappingNode {
+		return lines
+	}
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		lines[node.Content[i].Value] = node.Content[i].Line
+	}
+	return lines
+}
+
+var (
+	tomlTable = regexp.MustCompile(`^\s*\[\s*([^\]]+?)\s*\]`)
+	tomlKey   = regexp.MustCompile(`^\s*("[^"]*"|[A-Za-z0-9_-]+)\s*=`)
+)
+
+// tomlKeyLines returns the line of each top-level key of a TOML file and of
+// each key of its [profiles.<name>] tables
+func tomlKeyLines(data []byte) (map[string]int, map[string]map[string]int) {
+	lines := make(map[string]int)
+	profiles := make(map[string]map[string]int)
+	table := ""
+	for i, line := range strings.Split(string(data), "\n") {
+		if m := tomlTable.FindStringSubmatch(line); m != nil {
+			table = m[1]
+			continue
+		}
+		m := tomlKey.FindStringSubmatch(line)
+		if m == nil {
+			continue
+		}
+		key := strings.Trim(m[1], `"`)
+		if table == "" {
+			lines[key] = i + 1
+		} else if name, ok := strings.CutPrefix(table, "profiles."); ok {
+			name = strings.Trim(name, `"`)
+			if profiles[name] == nil {
+				profiles[name] = make(map[string]int)
+			}
+			profiles[name][key] = i + 1
+		}
+	}
+	return lines, profiles
+}
+
+// FindProjectConfig looks for a project configuration file in dir and its
+// parents. It returns an empty path when there is none.
+func FindProjectConfig(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+
+	for {
+		for _, name := range ProjectConfigNames {
+			path := filepath.Join(dir, name)
+			if info, err := os.Stat(path); err == nil && !info.IsDir() {
+				return path, nil
+			}
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// FindUserConfig returns the user configuration file in
+// $XDG_CONFIG_HOME/scopy (or ~/.config/scopy), or an empty path
+func FindUserConfig() string {
+	base := os.Getenv("XDG_CONFIG_HOME")
+	if base == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		base = filepath.Join(home, ".config")
+	}
+
+	for _, name := range userConfigNames {
+		path := filepath.Join(base, "scopy", name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path
+		}
+	}
+	return ""
+}
+
+// ConfigChain is the ordered list of configuration files in effect, from the
+// lowest to the highest precedence
+type ConfigChain []*ConfigFile
+
+// LoadConfigChain loads the user configuration file and the project
+// configuration file found from dir upward. When explicit is set, only that
+// file is loaded.
+func LoadConfigChain(dir, explicit string) (ConfigChain, error) {
+	chain, err := loadConfigChain(dir, explicit)
+	return chain, NewError(KindConfig, err)
+}
+
+func loadConfigChain(dir, explicit string) (ConfigChain, error) {
+	if explicit != "" {
+		cfg, err := LoadConfigFile(explicit)
+		if err != nil {
+			return nil, err
+		}
+		return ConfigChain{cfg}, nil
+	}
+
+	var chain ConfigChain
+	if path := FindUserConfig(); path != "" {
+		cfg, err := LoadConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cfg)
+	}
+
+	path, err := FindProjectConfig(dir)
+	if err != nil {
+		return nil, err
+	}
+	if path != "" {
+		cfg, err := LoadConfigFile(path)
+		if err != nil {
+			return nil, err
+		}
+		chain = append(chain, cfg)
+	}
+
+	return chain, nil
+}
+
+// Apply layers the files of the chain onto opts
+func (c ConfigChain) Apply(opts *Options) error {
+	for _, cfg := range c {
+		if err := cfg.apply(opts); err != nil {
+			return NewError(KindConfig, fmt.Errorf("error parsing %s: %v", cfg.Path, err))
+		}
+	}
+	return nil
+}
+
+// Origin returns where the chain sets the option key, as "path:line" in the
+// last file setting it, or "" when no file does
+func (c ConfigChain) Origin(key string) string {
+	for i := len(c) - 1; i >= 0; i-- {
+		if line, ok := c[i].lines[key]; ok {
+			return fmt.Sprintf("%s:%d", displayConfigPath(c[i].Path), line)
+		}
+	}
+	return ""
+}
+
+// ProfileOrigin returns where the named profile sets the option key, or ""
+// when it doesn't
+func (c ConfigChain) ProfileOrigin(profile, key string) string {
+	for i := len(c) - 1; i >= 0; i-- {
+		lines, ok := c[i].profileLines[profile]
+		if !ok {
+			continue
+		}
+		if line, ok := lines[key]; ok {
+			return fmt.Sprintf("%s:%d, profile %s", displayConfigPath(c[i].Path), line, profile)
+		}
+		return ""
+	}
+	return ""
+}
+
+// displayConfigPath shortens the path of a configuration file under the
+// current directory
+func displayConfigPath(path string) string {
+	wd, err := os.Getwd()
+	if err != nil {
+		return path
+	}
+	if rel, err := filepath.Rel(wd, path); err == nil && !strings.HasPrefix(rel, "..") {
+		return rel
+	}
+	return path
+}
+
+// ApplyProfile layers the named profile onto opts. A profile may be defined
+// in any of the files; a later file replaces a profile of the same name.
+func (c ConfigChain) ApplyProfile(opts *Options, profile string) error {
+	profiles := make(map[string]*ConfigFile)
+	for _, cfg := range c {
+		for name := range cfg.profiles {
+			profiles[name] = cfg
+		}
+	}
+
+	cfg, ok := profiles[profile]
+	if !ok {
+		names := make([]string, 0, len(profiles))
+		for name := range profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		if len(names) == 0 {
+			return NewError(KindConfig, fmt.Errorf("unknown profile %q: no profiles are defined", profile))
+		}
+		return NewError(KindConfig, fmt.Errorf("unknown profile %q (available: %s)", profile, strings.Join(names, ", ")))
+	}
+	return NewError(KindConfig, cfg.profiles[profile](opts))
+}
@@ -0,0 +1,316 @@
+package pkg
+
+import (
+	"fmt"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Dependencies returns the entry files followed by the local files they
+// import, nearest first, following at most depth levels of imports (all of
+// them when depth is negative). A Go entry brings the other files of its
+// package, and Go imports of packages of the entry's own module give every
+// file of the package; relative imports are followed in
+// JavaScript, TypeScript and Python. Other imports, like those of the standard
+// library or of third-party packages, are left out. Entries that can't be
+// read, and files whose imports can't be, are errors of kind KindIO; an
+// entry naming a directory is of kind KindUsage.
+func Dependencies(entries []string, depth int) ([]string, error) {
+	r := &depResolver{modules: map[string]goModule{}}
+	seen := map[string]bool{}
+	var files, level []string
+	for _, entry := range entries {
+		info, err := os.Stat(filepath.FromSlash(entry))
+		if err != nil {
+			return nil, NewError(KindIO, err)
+		}
+		if info.IsDir() {
+			return nil, NewError(KindUsage, fmt.Errorf("%s is a directory: --from takes files", entry))
+		}
+		abs, err := filepath.Abs(filepath.FromSlash(entry))
+		if err != nil {
+			return nil, NewError(KindIO, err)
+		}
+		rel, err := relativePaths([]string{abs})
+		if err != nil {
+			return nil, NewError(KindIO, err)
+		}
+		if path := rel[0]; !seen[path] {
+			seen[path] = true
+			files = append(files, path)
+			level = append(level, path)
+		}
+	}
+
+	// A Go file needs the other files of its package, which it uses without
+	// importing them
+	if depth != 0 {
+		for _, entry := range files {
+			if !strings.EqualFold(filepath.Ext(entry), ".go") || strings.HasSuffix(entry, "_test.go") {
+				continue
+			}
+			for _, path := range packageFiles(filepath.Dir(entry)) {
+				if !seen[path] {
+					seen[path] = true
+					files = append(files, path)
+					level = append(level, path)
+				}
+			}
+		}
+	}
+
+	for d := 0; len(level) > 0 && (depth < 0 || d < depth); d++ {
+		var next []string
+		for _, file := range level {
+			imports, err := r.imports(file)
+			if err != nil {
+				return nil, NewError(KindIO, fmt.Errorf("error reading imports of %s: %v", file, err))
+			}
+			for _, dep := range imports {
+				if !seen[dep] {
+					seen[dep] = true
+					files = append(files, dep)
+					next = append(next, dep)
+				}
+			}
+		}
+		level = next
+	}
+	return files, nil
+}
+
+// packageFiles returns the files of the Go package in dir, without test
+// files and files excluded by build constraints, or nothing when dir holds
+// no buildable package
+func packageFiles(dir string) []string {
+	found, err := build.Default.ImportDir(dir, 0)
+	if err != nil {
+		return nil
+	}
+	var files []string
+	for _, name := range append(found.GoFiles, found.CgoFiles...) {
+		files = append(files, filepath.Join(dir, name))
+	}
+	return files
+}
+
+// goModule is a Go module: the directory of its go.mod and its path
+type goModule struct {
+	dir  string
+	path string
+}
+
+// depResolver finds the local files imported by a file, caching the module
+// of each directory
+type depResolver struct {
+	modules map[string]goModule
+}
+
+// imports returns the local files imported by file, in the order of the
+// imports
+func (r *depResolver) imports(file string) ([]string, error) {
+	switch strings.ToLower(filepath.Ext(file)) {
+	case ".go":
+		return r.goImports(file)
+	case ".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".mts", ".cts":
+		return jsImports(file)
+	case ".py", ".pyi":
+		return pythonImports(file)
+	}
+	return nil, nil
+}
+
+// goImports returns the files of the packages of the file's module imported
+// by a Go file. Test files and files excluded by build constraints are left
+// out.
+func (r *depResolver) goImports(file string) ([]string, error) {
+	f, err := parser.ParseFile(token.NewFileSet(), file, nil, parser.ImportsOnly)
+	if err != nil {
+		return nil, err
+	}
+	module, err := r.module(filepath.Dir(file))
+	if err != nil || module.path == "" {
+		return nil, err
+	}
+
+	var files []string
+	for _, spec := range f.Imports {
+		path, err := strconv.Unquote(spec.Path.Value)
+		if err != nil {
+			continue
+		}
+		rest, ok := strings.CutPrefix(path, module.path)
+		if !ok || rest != "" && !strings.HasPrefix(rest, "/") {
+			continue
+		}
+		files = append(files, packageFiles(filepath.Join(module.dir, filepath.FromSlash(rest)))...)
+	}
+	return relativePaths(files)
+}
+
+// moduleDirective matches the module path in a go.mod file
+var moduleDirective = regexp.MustCompile(`(?m)^module\s+("[^"]+"|\S+)`)
+
+// module returns the Go module containing dir, or an empty module when there
+// is no go.mod above it
+func (r *depResolver) module(dir string) (goModule, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return goModule{}, err
+	}
+	if module, ok := r.modules[abs]; ok {
+		return module, nil
+	}
+
+	var module goModule
+	data, err := os.ReadFile(filepath.Join(abs, "go.mod"))
+	switch {
+	case err == nil:
+		module.dir = abs
+		if m := moduleDirective.FindSubmatch(data); m != nil {
+			module.path = string(m[1])
+			if unquoted, err := strconv.Unquote(module.path); err == nil {
+				module.path = unquoted
+			}
+		}
+	case !os.IsNotExist(err):
+		return goModule{}, err
+	case filepath.Dir(abs) != abs:
+		if module, err = r.module(filepath.Dir(abs)); err != nil {
+			return goModule{}, err
+		}
+	}
+	r.modules[abs] = module
+	return module, nil
+}
+
+// jsImport matches the module specifiers of import and export statements,
+// require calls and dynamic imports
+var jsImport = regexp.MustCompile(`(?:\b(?:import|export)\s[^'";]*?\bfrom\s*|\bimport\s*|\b(?:require|import)\s*\(\s*)['"]([^'"\n]+)['"]`)
+
+// jsExtensions are tried, in order, on specifiers that don't name a file
+var jsExtensions = []string{".ts", ".tsx", ".js", ".jsx", ".mts", ".mjs", ".cts", ".cjs", ".d.ts"}
+
+// jsImports returns the files imported with relative specifiers, like
+// "./util" or "../lib/api.js", by a JavaScript or TypeScript file
+func jsImports(file string) ([]string, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, m := range jsImport.FindAllSubmatch(src, -1) {
+		spec := string(m[1])
+		if !strings.HasPrefix(spec, "./") && !strings.HasPrefix(spec, "../") && spec != "." && spec != ".." {
+			continue
+		}
+		if path, ok := resolveJS(filepath.Join(filepath.Dir(file), filepath.FromSlash(spec))); ok {
+			files = append(files, path)
+		}
+	}
+	return files, nil
+}
+
+// resolveJS finds the file of a relative specifier the way bundlers do: the
+// path itself, the path with an extension, or an index file when the path is
+// a directory. TypeScript sources imported as ".js" are found too.
+func resolveJS(base string) (string, bool) {
+	candidates := []string{base}
+	ext := filepath.Ext(base)
+	switch ext {
+	case ".js", ".jsx", ".mjs", ".cjs":
+		stem := strings.TrimSuffix(base, ext)
+		ts := map[string][]string{".js": {".ts", ".tsx"}, ".jsx": {".tsx"}, ".mjs": {".mts"}, ".cjs": {".cts"}}
+		for _, e := range ts[ext] {
+			candidates = append(candidates, stem+e)
+		}
+	}
+	for _, e := range jsExtensions {
+		candidates = append(candidates, base+e)
+	}
+	for _, e := range jsExtensions {
+		candidates = append(candidates, filepath.Join(base, "index"+e))
+	}
+	return firstFile(candidates)
+}
+
+// pythonImport matches the relative imports of Python, like
+// "from .models import User" or "from .. import (a, b)"
+var pythonImport = regexp.MustCompile(`(?m)^[ \t]*from[ \t]+(\.+)([\w.]*)[ \t]+import[ \t]+(\([^)]*\)|[^\n#]*)`)
+
+// pythonImports returns the modules imported with relative imports by a
+// Python file. A name imported from a package is followed when it is a
+// submodule; otherwise the package's __init__.py is.
+func pythonImports(file string) ([]string, error) {
+	src, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, m := range pythonImport.FindAllSubmatch(src, -1) {
+		dir := filepath.Dir(file)
+		for i := 1; i < len(m[1]); i++ {
+			dir = filepath.Join(dir, "..")
+		}
+		if module := string(m[2]); module != "" {
+			dir = filepath.Join(dir, filepath.FromSlash(strings.ReplaceAll(module, ".", "/")))
+			if path, ok := firstFile([]string{dir + ".py", dir + ".pyi"}); ok {
+				files = append(files, path)
+				continue
+			}
+		}
+
+		found := false
+		for _, name := range strings.Split(strings.Trim(string(m[3]), "() \t\r\n"), ",") {
+			name, _, _ = strings.Cut(strings.TrimSpace(name), " ")
+			if name == "" || name == "*" {
+				continue
+			}
+			base := filepath.Join(dir, name)
+			if path, ok := firstFile([]string{base + ".py", base + ".pyi", filepath.Join(base, "__init__.py")}); ok {
+				files = append(files, path)
+				found = true
+			}
+		}
+		if !found {
+			if path, ok := firstFile([]string{filepath.Join(dir, "__init__.py")}); ok {
+				files = append(files, path)
+			}
+		}
+	}
+	return files, nil
+}
+
+// firstFile returns the first of paths that is a regular file
+func firstFile(paths []string) (string, bool) {
+	for _, path := range paths {
+		if info, err := os.Stat(path); err == nil && info.Mode().IsRegular() {
+			return filepath.Clean(path), true
+		}
+	}
+	return "", false
+}
+
+// relativePaths makes absolute paths relative to the current directory, like
+// the paths of the entries
+func relativePaths(paths []string) ([]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	for i, path := range paths {
+		if rel, err := filepath.Rel(wd, path); err == nil {
+			paths[i] = rel
+		}
+	}
+	return paths, nil
+}
@@ -0,0 +1,120 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+// depsTree is a project with Go, JavaScript and Python files importing each
+// other
+var depsTree = map[string]string{
+	"go.mod": "module example.com/app\n",
+	"main.go": `package main
+
+import (
+	"fmt"
+
+	"example.com/app/store"
+	"github.com/other/lib"
+)
+`,
+	"util.go":      "package main\n",
+	"main_test.go": "package main\n",
+	"store/store.go": `package store
+
+import "example.com/app/store/disk"
+`,
+	"store/store_test.go": "package store\n",
+	"store/ignored.go":    "//go:build ignore\n\npackage store\n",
+	"store/disk/disk.go":  "package disk\n",
+
+	// Index files, extension probing, TypeScript imported as ".js" and a cycle
+	"web/app.js": `import { a } from "./lib";
+import React from "react";
+const b = require("../shared/b.js");
+import "./missing";
+`,
+	"web/lib/index.ts": "export * from \"./a\";\nimport \"../app.js\";\n",
+	"web/lib/a.tsx":    "export const a = 1;\n",
+	"shared/b.ts":      "export const b = 2;\n",
+
+	// Relative imports of submodules, of names and of the parent package
+	"py/config.py":       "DEBUG = False\n",
+	"py/pkg/__init__.py": "def helper():\n    pass\n",
+	"py/pkg/models.py":   "from . import utils\nfrom .base import Base\n",
+	"py/pkg/utils.py":    "from .models import Model\n",
+	"py/pkg/base.py":     "from .. import config\n",
+	"py/pkg/views.py":    "from . import helper\nimport os\n",
+}
+
+func TestDependencies(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, depsTree, nil)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tests := []struct {
+		name    string
+		entries []string
+		depth   int
+		want    []string
+	}{
+		{
+			name: "go package and module imports", entries: []string{"main.go"}, depth: -1,
+			want: []string{"main.go", "util.go", "store/store.go", "store/disk/disk.go"},
+		},
+		{
+			name: "go depth limit", entries: []string{"main.go"}, depth: 1,
+			want: []string{"main.go", "util.go", "store/store.go"},
+		},
+		{
+			name: "depth zero", entries: []string{"main.go"}, depth: 0,
+			want: []string{"main.go"},
+		},
+		{
+			name: "js index, extensions and cycle", entries: []string{"web/app.js"}, depth: -1,
+			want: []string{"web/app.js", "web/lib/index.ts", "shared/b.ts", "web/lib/a.tsx"},
+		},
+		{
+			name: "python relative imports and cycle", entries: []string{"py/pkg/models.py"}, depth: -1,
+			want: []string{"py/pkg/models.py", "py/pkg/utils.py", "py/pkg/base.py", "py/config.py"},
+		},
+		{
+			name: "python name of the package", entries: []string{"py/pkg/views.py"}, depth: -1,
+			want: []string{"py/pkg/views.py", "py/pkg/__init__.py"},
+		},
+		{
+			name: "repeated entries", entries: []string{"shared/b.ts", "./shared/b.ts", "web/lib/a.tsx"}, depth: -1,
+			want: []string{"shared/b.ts", "web/lib/a.tsx"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Dependencies(tt.entries, tt.depth)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var want []string
+			for _, path := range tt.want {
+				want = append(want, filepath.FromSlash(path))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("Dependencies(%q, %d) = %q, want %q", tt.entries, tt.depth, got, want)
+			}
+		})
+	}
+
+	for entry, kind := range map[string]ErrorKind{"missing.go": KindIO, "store": KindUsage} {
+		if _, err := Dependencies([]string{entry}, -1); KindOf(err) != kind {
+			t.Errorf("Dependencies(%q) error = %v (kind %v), want kind %v", entry, err, KindOf(err), kind)
+		}
+	}
+}
@@ -0,0 +1,328 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// Encodings understood by the content reader
+const (
+	EncodingUTF8        = "utf-8"
+	EncodingUTF16LE     = "utf-16le"
+	EncodingUTF16BE     = "utf-16be"
+	EncodingLatin1      = "iso-8859-1"
+	EncodingWindows1252 = "windows-1252"
+)
+
+// DefaultFallbackEncoding is used for content that is neither UTF-8 nor UTF-16
+const DefaultFallbackEncoding = EncodingWindows1252
+
+// sniffSize is the number of bytes inspected to detect the encoding of a file
+const sniffSize = 8 * 1024
+
+var (
+	bomUTF8    = []byte{0xEF, 0xBB, 0xBF}
+	bomUTF16LE = []byte{0xFF, 0xFE}
+	bomUTF16BE = []byte{0xFE, 0xFF}
+)
+
+// encodingAliases maps accepted charset names to their canonical form
+var encodingAliases = map[string]string{
+	"utf-8":        EncodingUTF8,
+	"utf8":         EncodingUTF8,
+	"latin1":       EncodingLatin1,
+	"latin-1":      EncodingLatin1,
+	"iso-8859-1":   EncodingLatin1,
+	"iso8859-1":    EncodingLatin1,
+	"windows-1252": EncodingWindows1252,
+	"cp1252":       EncodingWindows1252,
+}
+
+// ParseFallbackEncoding returns the canonical name of a fallback charset
+func ParseFallbackEncoding(name string) (string, error) {
+	if name == "" {
+		return DefaultFallbackEncoding, nil
+	}
+	if canonical, ok := encodingAliases[strings.ToLower(name)]; ok {
+		return canonical, nil
+	}
+	return "", fmt.Errorf("unsupported fallback encoding %q (expected utf-8, latin1 or windows-1252)", name)
+}
+
+// decodeReader detects the encoding of src and returns a reader producing
+// UTF-8 without byte order mark, along with the detected encoding.
+// Detection looks at the byte order mark first, then at the distribution of
+// NUL bytes typical of UTF-16 text, and finally checks whether the content
+// is valid UTF-8. Anything else is decoded using the fallback charset.
+// Detection reads the first sniffSize bytes; when they are all ASCII, which
+// both UTF-8 and the fallback charset decode alike, the choice between them
+// is made on the sniffSize bytes from the first non-ASCII one, and the
+// encoding returned is only known once the content is read (see
+// decodedEncoding).
+func decodeReader(src io.Reader, fallback string) (io.Reader, string, error) {
+	reader := bufio.NewReaderSize(src, sniffSize)
+	sample, err := reader.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return nil, "", err
+	}
+
+	switch {
+	case bytes.HasPrefix(sample, bomUTF8):
+		reader.Discard(len(bomUTF8))
+		return reader, EncodingUTF8, nil
+	case bytes.HasPrefix(sample, bomUTF16LE):
+		reader.Discard(len(bomUTF16LE))
+		return &utf16Reader{src: reader, littleEndian: true}, EncodingUTF16LE, nil
+	case bytes.HasPrefix(sample, bomUTF16BE):
+		reader.Discard(len(bomUTF16BE))
+		return &utf16Reader{src: reader}, EncodingUTF16BE, nil
+	}
+
+	if enc := sniffUTF16(sample); enc != "" {
+		return &utf16Reader{src: reader, littleEndian: enc == EncodingUTF16LE}, enc, nil
+	}
+
+	if len(sample) == sniffSize && isASCII(sample) {
+		return &asciiReader{src: reader, fallback: fallback, encoding: EncodingUTF8}, EncodingUTF8, nil
+	}
+	decoded, enc := textDecoder(reader, sample, fallback)
+	return decoded, enc, nil
+}
+
+// textDecoder returns the reader of text that is UTF-8 when sample, its
+// start, is valid UTF-8, and in the fallback charset otherwise
+func textDecoder(reader *bufio.Reader, sample []byte, fallback string) (io.Reader, string) {
+	if validUTF8Prefix(sample, len(sample) == sniffSize) {
+		return reader, EncodingUTF8
+	}
+	switch fallback {
+	case EncodingLatin1:
+		return &singleByteReader{src: reader, table: &latin1Table}, EncodingLatin1
+	case EncodingWindows1252, "":
+		return &singleByteReader{src: reader, table: &windows1252Table}, EncodingWindows1252
+	}
+	return reader, EncodingUTF8
+}
+
+// decodedEncoding returns the encoding of the content of a reader returned
+// by decodeReader with the encoding detected, once the content is read
+func decodedEncoding(decoded io.Reader, detected string) string {
+	if r, ok := decoded.(*asciiReader); ok {
+		return r.encoding
+	}
+	return detected
+}
+
+// isASCII reports whether data holds ASCII characters only
+func isASCII(data []byte) bool {
+	for _, b := range data {
+		if b >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// asciiReader passes on content whose start is ASCII, and picks its
+// decoder with textDecoder at the first non-ASCII byte. The bytes before
+// it read the same in every charset it can pick.
+type asciiReader struct {
+	src      *bufio.Reader
+	fallback string
+	decoded  io.Reader
+	encoding string
+}
+
+func (r *asciiReader) Read(p []byte) (int, error) {
+	if r.decoded != nil {
+		return r.decoded.Read(p)
+	}
+	if r.src.Buffered() == 0 {
+		if _, err := r.src.Peek(1); err != nil {
+			return 0, err
+		}
+	}
+	buffered, _ := r.src.Peek(r.src.Buffered())
+	ascii := 0
+	for ascii < len(buffered) && buffered[ascii] < utf8.RuneSelf {
+		ascii++
+	}
+	if ascii > 0 {
+		return r.src.Read(p[:min(len(p), ascii)])
+	}
+
+	sample, err := r.src.Peek(sniffSize)
+	if err != nil && err != io.EOF && err != bufio.ErrBufferFull {
+		return 0, err
+	}
+	r.decoded, r.encoding = textDecoder(r.src, sample, r.fallback)
+	return r.decoded.Read(p)
+}
+
+// sniffUTF16 recognizes UTF-16 text without byte order mark. Text made mostly
+// of ASCII characters has a NUL byte in every other position, on the odd
+// offsets for little endian and on the even offsets for big endian.
+func sniffUTF16(sample []byte) string {
+	pairs := len(sample) / 2
+	if pairs < 2 {
+		return ""
+	}
+
+	evenZeros, oddZeros := 0, 0
+	for i := 0; i+1 < len(sample); i += 2 {
+		if sample[i] == 0 {
+			evenZeros++
+		}
+		if sample[i+1] == 0 {
+			oddZeros++
+		}
+	}
+
+	// Require a clear majority on one side and almost nothing on the other
+	switch {
+	case oddZeros*10 >= pairs*6 && evenZeros*10 <= pairs:
+		return EncodingUTF16LE
+	case evenZeros*10 >= pairs*6 && oddZeros*10 <= pairs:
+		return EncodingUTF16BE
+	}
+	return ""
+}
+
+// validUTF8Prefix reports whether sample is valid UTF-8. When the sample was
+// cut from a longer file, a rune split at the end is not treated as invalid.
+func validUTF8Prefix(sample []byte, truncated bool) bool {
+	if truncated {
+		for i := 0; i < utf8.UTFMax && len(sample) > 0; i++ {
+			if utf8.Valid(sample) {
+				return true
+			}
+			sample = sample[:len(sample)-1]
+		}
+	}
+	return utf8.Valid(sample)
+}
+
+// utf16Reader transcodes UTF-16 input into UTF-8
+type utf16Reader struct {
+	src          io.Reader
+	littleEndian bool
+	carry        []byte // Bytes of an incomplete code unit or surrogate pair
+	pending      []byte
+	err          error
+}
+
+func (r *utf16Reader) Read(p []byte) (int, error) {
+	for len(r.pending) == 0 {
+		if r.err != nil {
+			return 0, r.err
+		}
+		r.fill()
+	}
+	n := copy(p, r.pending)
+	r.pending = r.pending[n:]
+	return n, nil
+}
+
+// fill decodes the next chunk of code units into pending
+func (r *utf16Reader) fill() {
+	buf := make([]byte, readBufferSize)
+	start := copy(buf, r.carry)
+	n, err := io.ReadFull(r.src, buf[start:])
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	data := buf[:start+n]
+	r.carry = nil
+
+	// Keep an odd trailing byte or a dangling high surrogate for the next chunk
+	if err == nil {
+		keep := len(data) % 2
+		if unit := r.unit(data, len(data)-keep-2); unit >= 0xD800 && unit < 0xDC00 {
+			keep += 2
+		}
+		r.carry = append(r.carry, data[len(data)-keep:]...)
+		data = data[:len(data)-keep]
+	}
+
+	units := make([]uint16, 0, len(data)/2+1)
+	for i := 0; i+1 < len(data); i += 2 {
+		units = append(units, r.unit(data, i))
+	}
+	if len(data)%2 == 1 {
+		// A lone trailing byte at the end of the file can't be decoded
+		units = append(units, utf8.RuneError)
+	}
+
+	out := make([]byte, 0, len(units)*2)
+	for _, rn := range utf16.Decode(units) {
+		out = utf8.AppendRune(out, rn)
+	}
+	r.pending = out
+	r.err = err
+}
+
+// unit returns the code unit starting at offset i of data
+func (r *utf16Reader) unit(data []byte, i int) uint16 {
+	if i < 0 || i+1 >= len(data) {
+		return 0
+	}
+	if r.littleEndian {
+		return uint16(data[i]) | uint16(data[i+1])<<8
+	}
+	return uint16(data[i])<<8 | uint16(data[i+1])
+}
+
+// singleByteReader transcodes a single-byte charset into UTF-8
+type singleByteReader struct {
+	src   io.Reader
+	table *[256]rune
+	buf   []byte
+	out   []byte
+}
+
+func (r *singleByteReader) Read(p []byte) (int, error) {
+	if len(r.out) == 0 {
+		if r.buf == nil {
+			r.buf = make([]byte, readBufferSize)
+		}
+		n, err := r.src.Read(r.buf)
+		out := r.out[:0]
+		for _, b := range r.buf[:n] {
+			out = utf8.AppendRune(out, r.table[b])
+		}
+		r.out = out
+		if n == 0 {
+			return 0, err
+		}
+	}
+	n := copy(p, r.out)
+	r.out = r.out[n:]
+	return n, nil
+}
+
+// latin1Table maps ISO-8859-1 bytes to their Unicode code points
+var latin1Table = func() (t [256]rune) {
+	for i := range t {
+		t[i] = rune(i)
+	}
+	return t
+}()
+
+// windows1252Table maps Windows-1252 bytes to Unicode. It differs from
+// ISO-8859-1 only in the 0x80-0x9F range.
+var windows1252Table = func() (t [256]rune) {
+	t = latin1Table
+	high := [32]rune{
+		0x20AC, 0xFFFD, 0x201A, 0x0192, 0x201E, 0x2026, 0x2020, 0x2021,
+		0x02C6, 0x2030, 0x0160, 0x2039, 0x0152, 0xFFFD, 0x017D, 0xFFFD,
+		0xFFFD, 0x2018, 0x2019, 0x201C, 0x201D, 0x2022, 0x2013, 0x2014,
+		0x02DC, 0x2122, 0x0161, 0x203A, 0x0153, 0xFFFD, 0x017E, 0x0178,
+	}
+	copy(t[0x80:0xA0], high[:])
+	return t
+}()
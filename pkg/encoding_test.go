@@ -0,0 +1,110 @@
+package pkg
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+	"unicode/utf16"
+)
+
+// encodeUTF16 encodes s in UTF-16, little or big endian
+func encodeUTF16(s string, littleEndian bool) []byte {
+	var out []byte
+	for _, unit := range utf16.Encode([]rune(s)) {
+		if littleEndian {
+			out = append(out, byte(unit), byte(unit>>8))
+		} else {
+			out = append(out, byte(unit>>8), byte(unit))
+		}
+	}
+	return out
+}
+
+func TestDecodeReader(t *testing.T) {
+	ascii := strings.Repeat("a", sniffSize)
+	tests := []struct {
+		name     string
+		src      []byte
+		fallback string
+		want     string
+		encoding string
+	}{
+		{name: "utf-8", src: []byte("café\n"), want: "café\n", encoding: EncodingUTF8},
+		{name: "utf-8 bom", src: []byte("\xEF\xBB\xBFcafé\n"), want: "café\n", encoding: EncodingUTF8},
+		{name: "utf-16le bom", src: append([]byte{0xFF, 0xFE}, encodeUTF16("café 😀\n", true)...), want: "café 😀\n", encoding: EncodingUTF16LE},
+		{name: "utf-16be bom", src: append([]byte{0xFE, 0xFF}, encodeUTF16("café 😀\n", false)...), want: "café 😀\n", encoding: EncodingUTF16BE},
+		{name: "utf-16le without bom", src: encodeUTF16("package main\n\nfunc é() {}\n", true), want: "package main\n\nfunc é() {}\n", encoding: EncodingUTF16LE},
+		{name: "utf-16be without bom", src: encodeUTF16("package main\n\nfunc é() {}\n", false), want: "package main\n\nfunc é() {}\n", encoding: EncodingUTF16BE},
+		{name: "windows-1252", src: []byte("caf\xE9 \x80\n"), want: "café €\n", encoding: EncodingWindows1252},
+		{name: "latin1", src: []byte("caf\xE9 \x80\n"), fallback: EncodingLatin1, want: "café \u0080\n", encoding: EncodingLatin1},
+		{name: "fallback utf-8", src: []byte("caf\xE9\n"), fallback: EncodingUTF8, want: "caf\xE9\n", encoding: EncodingUTF8},
+		{name: "empty", src: nil, want: "", encoding: EncodingUTF8},
+		// The charset of content starting with more ASCII than the sample is
+		// decided at its first other byte
+		{name: "windows-1252 after the sample", src: []byte(ascii + "caf\xE9\n"), want: ascii + "café\n", encoding: EncodingWindows1252},
+		{name: "utf-8 after the sample", src: []byte(ascii + "café\n"), want: ascii + "café\n", encoding: EncodingUTF8},
+		{name: "ascii longer than the sample", src: []byte(ascii + ascii), want: ascii + ascii, encoding: EncodingUTF8},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fallback := tt.fallback
+			if fallback == "" {
+				fallback = DefaultFallbackEncoding
+			}
+			decoded, encoding, err := decodeReader(iotest.OneByteReader(bytes.NewReader(tt.src)), fallback)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := io.ReadAll(iotest.OneByteReader(decoded))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("content = %q, want %q", abbreviate(string(got)), abbreviate(tt.want))
+			}
+			if encoding = decodedEncoding(decoded, encoding); encoding != tt.encoding {
+				t.Errorf("encoding = %s, want %s", encoding, tt.encoding)
+			}
+		})
+	}
+}
+
+func TestUTF16Reader(t *testing.T) {
+	// Code units before the pair, so that its high surrogate ends the first
+	// chunk read and its low surrogate starts the next one
+	before := strings.Repeat("a", readBufferSize/2-1)
+	tests := []struct {
+		name string
+		text string
+		src  []byte
+		want string
+	}{
+		{name: "surrogate pair split across reads", text: before + "😀b"},
+		{name: "code unit split across reads", text: "x" + before + "é😀b"},
+		{name: "several chunks", text: strings.Repeat("ação 😀\n", readBufferSize/4)},
+		{name: "lone trailing byte", src: append(encodeUTF16("ab", true), 'c'), want: "ab�"},
+		{name: "unpaired surrogate", src: []byte{'a', 0, 0x3D, 0xD8, 'b', 0}, want: "a�b"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			for _, littleEndian := range []bool{true, false} {
+				src, want := tt.src, tt.want
+				if src == nil {
+					src, want = encodeUTF16(tt.text, littleEndian), tt.text
+				} else if !littleEndian {
+					continue
+				}
+				r := &utf16Reader{src: iotest.OneByteReader(bytes.NewReader(src)), littleEndian: littleEndian}
+				got, err := io.ReadAll(r)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if string(got) != want {
+					t.Errorf("little endian %v: content = %q, want %q", littleEndian, abbreviate(string(got)), abbreviate(want))
+				}
+			}
+		})
+	}
+}
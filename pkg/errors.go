@@ -0,0 +1,70 @@
+package pkg
+
+import (
+	"errors"
+)
+
+// ErrorKind classifies the errors returned by this package
+type ErrorKind int
+
+const (
+	KindUsage          ErrorKind = iota + 1 // Invalid options or arguments
+	KindConfig                              // Unreadable or invalid configuration
+	KindIO                                  // Files or output could not be read or written
+	KindPartial                             // Some files could not be processed
+	KindNothingMatched                      // No file matched the selection
+	KindCanceled                            // The run was interrupted or timed out
+)
+
+// String names the kind of error
+func (k ErrorKind) String() string {
+	switch k {
+	case KindUsage:
+		return "usage"
+	case KindConfig:
+		return "config"
+	case KindIO:
+		return "io"
+	case KindPartial:
+		return "partial"
+	case KindNothingMatched:
+		return "nothing-matched"
+	case KindCanceled:
+		return "canceled"
+	}
+	return "unknown"
+}
+
+// Error is an error with a kind, so callers can react to classes of failures
+type Error struct {
+	Kind ErrorKind
+	Err  error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// ErrNothingMatched is returned when FailOnEmpty is set and no file was selected
+var ErrNothingMatched = &Error{Kind: KindNothingMatched, Err: errors.New("no files matched the selection")}
+
+// KindOf returns the kind of err, or 0 when err carries none
+func KindOf(err error) ErrorKind {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Kind
+	}
+	return 0
+}
+
+// NewError classifies err with kind, keeping the kind err may already have
+func NewError(kind ErrorKind, err error) error {
+	if err == nil || KindOf(err) != 0 {
+		return err
+	}
+	return &Error{Kind: kind, Err: err}
+}
@@ -0,0 +1,22 @@
+//go:build !unix
+
+package pkg
+
+import (
+	"os"
+)
+
+// fileID identifies a file on disk, whatever the path it is reached by.
+// Without inodes, files are identified by their real path.
+type fileID struct {
+	path string
+}
+
+// fileIdentity returns the real path of the file at path
+func fileIdentity(path string, info os.FileInfo) (fileID, bool) {
+	real, err := realPath(path)
+	if err != nil {
+		return fileID{}, false
+	}
+	return fileID{path: real}, true
+}
@@ -0,0 +1,23 @@
+//go:build unix
+
+package pkg
+
+import (
+	"os"
+	"syscall"
+)
+
+// fileID identifies a file on disk, whatever the path it is reached by
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// fileIdentity returns the device and inode of the file described by info
+func fileIdentity(path string, info os.FileInfo) (fileID, bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileID{}, false
+	}
+	return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}, true
+}
@@ -0,0 +1,371 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// SetsDir is the directory, relative to the project root, where named sets
+// of files are saved
+const SetsDir = ".scopy/sets"
+
+// FindSetsRoot returns the project root holding the sets seen from dir: the
+// nearest of dir and its parents with a SetsDir directory or, when there is
+// none, with a project configuration file, or else dir itself. The entries
+// of the sets are relative to it.
+func FindSetsRoot(dir string) (string, error) {
+	dir, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err
+	}
+	for parent := dir; ; parent = filepath.Dir(parent) {
+		if info, err := os.Stat(filepath.Join(parent, filepath.FromSlash(SetsDir))); err == nil && info.IsDir() {
+			return parent, nil
+		}
+		if filepath.Dir(parent) == parent {
+			break
+		}
+	}
+
+	config, err := FindProjectConfig(dir)
+	if err != nil || config == "" {
+		return dir, err
+	}
+	return filepath.Dir(config), nil
+}
+
+// FileSet is a named selection of files saved for later runs, so it can be
+// committed and replayed with identical output
+type FileSet struct {
+	Description string     `yaml:"description,omitempty"`
+	Files       []SetEntry `yaml:"files"`
+}
+
+// SetEntry is a file of a set, with its options, or a glob. In the file an
+// entry without options is written as its path alone.
+type SetEntry struct {
+	Path   string `yaml:"path"`
+	Lines  string `yaml:"lines,omitempty"`
+	Symbol string `yaml:"symbol,omitempty"` // Functions or types, comma-separated
+}
+
+// setEntryFields is SetEntry without its YAML methods
+type setEntryFields SetEntry
+
+// UnmarshalYAML reads an entry written as a path or as a mapping. Unknown
+// keys are errors, as in the rest of the file.
+func (e *SetEntry) UnmarshalYAML(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		return node.Decode(&e.Path)
+	}
+	if node.Kind == yaml.MappingNode {
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			switch key := node.Content[i].Value; key {
+			case "path", "lines", "symbol":
+			default:
+				return fmt.Errorf("line %d: unknown file option %q (expected path, lines or symbol)", node.Content[i].Line, key)
+			}
+		}
+	}
+	return node.Decode((*setEntryFields)(e))
+}
+
+// MarshalYAML writes an entry without options as its path
+func (e SetEntry) MarshalYAML() (interface{}, error) {
+	if e.Lines == "" && e.Symbol == "" {
+		return e.Path, nil
+	}
+	return setEntryFields(e), nil
+}
+
+// ParseSetEntry parses a path with an optional line range or symbols, as in
+// "pkg/processor.go:120-200" or "pkg/processor.go#processFile,copyEntry"
+func ParseSetEntry(arg string) (SetEntry, error) {
+	entry := SetEntry{Path: arg}
+	if m := lineSuffix.FindStringSubmatch(arg); m != nil {
+		entry.Path = arg[:len(arg)-len(m[0])]
+		entry.Lines = m[1]
+	} else if m := symbolSuffix.FindStringSubmatch(arg); m != nil {
+		entry.Path = arg[:len(arg)-len(m[0])]
+		entry.Symbol = m[1]
+	}
+	return entry, entry.validate()
+}
+
+var (
+	// lineSuffix is the line range at the end of a file argument
+	lineSuffix = regexp.MustCompile(`:([0-9]+(?:-[0-9]*)?)$`)
+
+	// symbolSuffix is the list of symbols at the end of a file argument
+	symbolSuffix = regexp.MustCompile(`#([A-Za-z_$][\w$.]*(?:,[A-Za-z_$][\w$.]*)*)$`)
+)
+
+// IsFileArg reports whether a command line argument names a file rather
+// than an extension: it has a line range or symbols, a path separator or a
+// wildcard, or it is the name of an existing file with an extension.
+func IsFileArg(arg string) bool {
+	if lineSuffix.MatchString(arg) || symbolSuffix.MatchString(arg) || strings.ContainsAny(arg, `/\*?[`) {
+		return true
+	}
+	if !strings.Contains(strings.TrimPrefix(arg, "."), ".") {
+		return false
+	}
+	info, err := os.Stat(arg)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// String formats the entry as parsed by ParseSetEntry
+func (e SetEntry) String() string {
+	switch {
+	case e.Lines != "":
+		return e.Path + ":" + e.Lines
+	case e.Symbol != "":
+		return e.Path + "#" + e.Symbol
+	}
+	return e.Path
+}
+
+// IsGlob reports whether the entry is a pattern rather than a path
+func (e SetEntry) IsGlob() bool {
+	return strings.ContainsAny(e.Path, "*?[")
+}
+
+func (e SetEntry) validate() error {
+	if e.Path == "" {
+		return fmt.Errorf("missing path")
+	}
+	if e.IsGlob() {
+		if _, err := path.Match(strings.ReplaceAll(e.Path, "**", "*"), ""); err != nil {
+			return fmt.Errorf("invalid glob %q: %v", e.Path, err)
+		}
+		if e.Lines != "" || e.Symbol != "" {
+			return fmt.Errorf("%s: a line range or symbol needs a single file, not a glob", e)
+		}
+		return nil
+	}
+	if e.Lines != "" && e.Symbol != "" {
+		return fmt.Errorf("%s: give either lines or symbol, not both", e.Path)
+	}
+	if e.Lines != "" {
+		if _, err := ParseLineRange(e.Lines); err != nil {
+			return fmt.Errorf("%s: %v", e.Path, err)
+		}
+	}
+	return nil
+}
+
+// Resolve returns the files of the set under dir, the directory its entries
+// are relative to, in the order of the set. Globs are matched against the
+// regular files under dir, in lexical order, where "**" matches any number of
+// directories; the .git directory is never searched. Symbols are looked up
+// with FindSymbol, so their files are read and must exist. The paths
+// returned are joined to dir, and files that don't exist are kept so the run
+// reports them. Invalid entries and symbols not
+// found are errors of kind KindUsage, read failures of kind KindIO.
+func (s FileSet) Resolve(dir string) ([]FileSpec, error) {
+	var files []FileSpec
+	var tree []string
+	for _, entry := range s.Files {
+		if err := entry.validate(); err != nil {
+			return nil, NewError(KindUsage, err)
+		}
+		file := filepath.Join(dir, filepath.FromSlash(entry.Path))
+		switch {
+		case entry.Symbol != "":
+			src, err := os.ReadFile(file)
+			if err != nil {
+				return nil, NewError(KindIO, err)
+			}
+			for _, symbol := range strings.Split(entry.Symbol, ",") {
+				ranges, err := FindSymbol(file, src, symbol)
+				if err != nil {
+					return nil, err
+				}
+				for _, lines := range ranges {
+					files = append(files, FileSpec{Path: file, Lines: lines, Symbol: symbol})
+				}
+			}
+			continue
+		case !entry.IsGlob():
+			var lines LineRange
+			if entry.Lines != "" {
+				lines, _ = ParseLineRange(entry.Lines)
+			}
+			files = append(files, FileSpec{Path: file, Lines: lines})
+			continue
+		}
+
+		if tree == nil {
+			var err error
+			if tree, err = listTree(dir); err != nil {
+				return nil, NewError(KindIO, err)
+			}
+		}
+		for _, file := range tree {
+			if matchGlob(entry.Path, file) {
+				files = append(files, FileSpec{Path: filepath.Join(dir, filepath.FromSlash(file))})
+			}
+		}
+	}
+	return files, nil
+}
+
+// listTree returns the regular files under dir, with slash-separated paths
+// relative to it. Like a normal run, it leaves out dot files and directories,
+// .git included, and the paths matched by the .gitignore of dir, so globs
+// match the same files in every checkout.
+func listTree(dir string) ([]string, error) {
+	ignore := NewGitIgnore()
+	if path := filepath.Join(dir, ".gitignore"); fileExists(path) {
+		if err := ignore.Load(path); err != nil {
+			return nil, fmt.Errorf("error loading .gitignore: %v", err)
+		}
+	}
+
+	files := []string{}
+	err := filepath.WalkDir(dir, func(file string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil || rel == "." {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), ".") || ignore.ShouldIgnore(rel) {
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		if d.Type().IsRegular() {
+			files = append(files, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	return files, err
+}
+
+// fileExists reports whether path exists and is a regular file
+func fileExists(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// matchGlob matches a slash-separated path against pattern, where "**" as a
+// whole component matches any number of directories
+func matchGlob(pattern, name string) bool {
+	return matchComponents(strings.Split(pattern, "/"), strings.Split(name, "/"))
+}
+
+func matchComponents(pattern, name []string) bool {
+	for len(pattern) > 0 {
+		if pattern[0] == "**" {
+			for i := 0; i <= len(name); i++ {
+				if matchComponents(pattern[1:], name[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(name) == 0 {
+			return false
+		}
+		if ok, _ := path.Match(pattern[0], name[0]); !ok {
+			return false
+		}
+		pattern, name = pattern[1:], name[1:]
+	}
+	return len(name) == 0
+}
+
+// setNamePattern restricts set names to what is safe as a file name
+var setNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*$`)
+
+// ValidateSetName checks that name can be used as the name of a set
+func ValidateSetName(name string) error {
+	if !setNamePattern.MatchString(name) {
+		return fmt.Errorf("invalid set name %q: use letters, digits, '.', '_' and '-'", name)
+	}
+	return nil
+}
+
+// SetPath returns the path of the file of the set name under dir
+func SetPath(dir, name string) string {
+	return filepath.Join(dir, SetsDir, name+".yaml")
+}
+
+// SaveFileSet writes set as the set name under dir, replacing any set of
+// the same name
+func SaveFileSet(dir, name string, set FileSet) error {
+	if err := ValidateSetName(name); err != nil {
+		return err
+	}
+	data, err := yaml.Marshal(set)
+	if err != nil {
+		return err
+	}
+	path := SetPath(dir, name)
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+// LoadFileSet reads the set name saved under dir. Unknown keys are errors.
+func LoadFileSet(dir, name string) (FileSet, error) {
+	var set FileSet
+	if err := ValidateSetName(name); err != nil {
+		return set, err
+	}
+	path := SetPath(dir, name)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return set, fmt.Errorf("unknown set %q", name)
+	}
+	if err != nil {
+		return set, err
+	}
+
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&set); err != nil && !errors.Is(err, io.EOF) {
+		return set, fmt.Errorf("error parsing %s: %v", path, err)
+	}
+	for _, entry := range set.Files {
+		if err := entry.validate(); err != nil {
+			return set, fmt.Errorf("error parsing %s: %v", path, err)
+		}
+	}
+	return set, nil
+}
+
+// ListFileSets returns the names of the sets saved under dir, sorted
+func ListFileSets(dir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, SetsDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, entry := range entries {
+		name := strings.TrimSuffix(entry.Name(), ".yaml")
+		if !entry.IsDir() && name != entry.Name() && ValidateSetName(name) == nil {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,211 @@
+package pkg
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	tests := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"*.go", "main.go", true},
+		{"*.go", "cmd/main.go", false},
+		{"cmd/*.go", "cmd/main.go", true},
+		{"**/*.go", "main.go", true},
+		{"**/*.go", "a/b/c/main.go", true},
+		{"pkg/**", "pkg/a/b.go", true},
+		{"pkg/**", "pkg", true},
+		{"pkg/**", "cmd/a.go", false},
+		// "**" gives back the directories the rest of the pattern needs
+		{"**/test/*.go", "a/test/b/test/c.go", true},
+		{"**/test/*.go", "a/test/b/c.go", false},
+		{"a/**/b/**/c.txt", "a/x/b/y/b/z/c.txt", true},
+		{"a/**/b/**/c.txt", "a/b/c.txt", true},
+		{"a/**/b", "a/b/c", false},
+		{"**", "anything/at/all", true},
+		{"src/?.go", "src/a.go", true},
+		{"src/[ab].go", "src/c.go", false},
+	}
+	for _, tt := range tests {
+		if got := matchGlob(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestIsFileArg(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"go.mod":     "module example.com/a\n",
+		"main.go":    "package main\n",
+		"src/app.js": "run()\n",
+	}, nil)
+	if err := os.Mkdir(filepath.Join(dir, "build.d"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	tests := []struct {
+		arg  string
+		want bool
+	}{
+		// Extensions, with or without their dot
+		{"go", false},
+		{"mod", false},
+		{".go", false},
+		// Existing files with an extension
+		{"go.mod", true},
+		{"main.go", true},
+		// A name with an extension that doesn't exist, or is a directory
+		{"other.go", false},
+		{"build.d", false},
+		// Paths, wildcards, ranges and symbols are files, existing or not
+		{"src/app.js", true},
+		{"src/missing.js", true},
+		{"*.go", true},
+		{"main.go:10-20", true},
+		{"missing.go:5", true},
+		{"main.go#main", true},
+	}
+	for _, tt := range tests {
+		if got := IsFileArg(tt.arg); got != tt.want {
+			t.Errorf("IsFileArg(%q) = %v, want %v", tt.arg, got, tt.want)
+		}
+	}
+}
+
+func TestParseSetEntry(t *testing.T) {
+	tests := []struct {
+		arg     string
+		want    SetEntry
+		wantErr bool
+	}{
+		{arg: "cmd/root.go", want: SetEntry{Path: "cmd/root.go"}},
+		{arg: "pkg/processor.go:120-200", want: SetEntry{Path: "pkg/processor.go", Lines: "120-200"}},
+		{arg: "a.go:42", want: SetEntry{Path: "a.go", Lines: "42"}},
+		{arg: "a.go:10-", want: SetEntry{Path: "a.go", Lines: "10-"}},
+		{arg: "a.go#processFile", want: SetEntry{Path: "a.go", Symbol: "processFile"}},
+		{arg: "a.go#Processor.run,copyEntry", want: SetEntry{Path: "a.go", Symbol: "Processor.run,copyEntry"}},
+		{arg: "pkg/**/*.go", want: SetEntry{Path: "pkg/**/*.go"}},
+		// A colon not followed by a range is part of the path
+		{arg: "c:notes.txt", want: SetEntry{Path: "c:notes.txt"}},
+		{arg: "a.go:20-10", wantErr: true},
+		{arg: "a.go:0", wantErr: true},
+		{arg: "pkg/*.go:1-2", wantErr: true},
+		{arg: "pkg/[.go", wantErr: true},
+		{arg: ":1-2", wantErr: true},
+	}
+	for _, tt := range tests {
+		got, err := ParseSetEntry(tt.arg)
+		if tt.wantErr {
+			if err == nil {
+				t.Errorf("ParseSetEntry(%q) = %+v, want an error", tt.arg, got)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("ParseSetEntry(%q): %v", tt.arg, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("ParseSetEntry(%q) = %+v, want %+v", tt.arg, got, tt.want)
+		}
+		if got.String() != tt.arg {
+			t.Errorf("ParseSetEntry(%q).String() = %q", tt.arg, got.String())
+		}
+	}
+}
+
+func TestFindSetsRoot(t *testing.T) {
+	tests := []struct {
+		name  string
+		files map[string]string
+		from  string
+		want  string
+	}{
+		{
+			name:  "sets directory above",
+			files: map[string]string{".scopy/sets/api.yaml": "files: []\n", "pkg/sub/a.go": ""},
+			from:  "pkg/sub",
+			want:  ".",
+		},
+		{
+			// The nearest sets directory wins over a configuration file
+			name:  "sets directory over configuration",
+			files: map[string]string{".scopy/sets/api.yaml": "", "web/.scopy.yaml": "", "web/src/a.js": ""},
+			from:  "web/src",
+			want:  ".",
+		},
+		{
+			name:  "configuration file",
+			files: map[string]string{"web/.scopy.yaml": "", "web/src/a.js": ""},
+			from:  "web/src",
+			want:  "web",
+		},
+		{
+			name:  "neither",
+			files: map[string]string{"pkg/a.go": ""},
+			from:  "pkg",
+			want:  "pkg",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, tt.files, nil)
+			dir, err := filepath.EvalSymlinks(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, err := FindSetsRoot(filepath.Join(dir, tt.from))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(dir, tt.want); got != want {
+				t.Errorf("FindSetsRoot = %s, want %s", got, want)
+			}
+		})
+	}
+}
+
+func TestResolveUnderRoot(t *testing.T) {
+	dir := t.TempDir()
+	writeTree(t, dir, map[string]string{
+		"cmd/main.go":  "package main\n\nfunc main() {}\n",
+		"pkg/a.go":     "package pkg\n",
+		"pkg/sub/b.go": "package sub\n",
+		"pkg/.tmp.go":  "package tmp\n",
+	}, nil)
+
+	set := FileSet{Files: []SetEntry{
+		{Path: "cmd/main.go", Symbol: "main"},
+		{Path: "pkg/**/*.go"},
+		{Path: "missing.go"},
+	}}
+	got, err := set.Resolve(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []FileSpec{
+		{Path: filepath.Join(dir, "cmd", "main.go"), Lines: LineRange{Start: 3, End: 3}, Symbol: "main"},
+		{Path: filepath.Join(dir, "pkg", "a.go")},
+		{Path: filepath.Join(dir, "pkg", "sub", "b.go")},
+		{Path: filepath.Join(dir, "missing.go")},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Resolve = %+v, want %+v", got, want)
+	}
+}
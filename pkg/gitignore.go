@@ -3,6 +3,9 @@ package pkg
 
 import (
 	"bufio"
+	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
@@ -10,13 +13,25 @@ import (
 
 // GitIgnore represents a .gitignore file parser
 type GitIgnore struct {
-	patterns []string
+	patterns []IgnorePattern
+}
+
+// IgnorePattern is a .gitignore pattern with the place it was read from
+type IgnorePattern struct {
+	Pattern string
+	Source  string // Path of the .gitignore file
+	Line    int
+}
+
+// String formats the pattern with its source, e.g. "*.log (.gitignore:3)"
+func (p IgnorePattern) String() string {
+	return fmt.Sprintf("%s (%s:%d)", p.Pattern, p.Source, p.Line)
 }
 
 // NewGitIgnore creates a new GitIgnore instance
 func NewGitIgnore() *GitIgnore {
 	return &GitIgnore{
-		patterns: make([]string, 0),
+		patterns: make([]IgnorePattern, 0),
 	}
 }
 
@@ -27,14 +42,30 @@ func (g *GitIgnore) Load(path string) error {
 		return err
 	}
 	defer file.Close()
+	return g.read(file, path)
+}
+
+// LoadFS loads patterns from the .gitignore file name of fsys
+func (g *GitIgnore) LoadFS(fsys fs.FS, name string) error {
+	file, err := fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return g.read(file, name)
+}
 
-	scanner := bufio.NewScanner(file)
+// read adds the patterns of a .gitignore file read from path
+func (g *GitIgnore) read(r io.Reader, path string) error {
+	scanner := bufio.NewScanner(r)
+	lineNumber := 0
 	for scanner.Scan() {
+		lineNumber++
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" || strings.HasPrefix(line, "#") {
 			continue
 		}
-		g.patterns = append(g.patterns, line)
+		g.patterns = append(g.patterns, IgnorePattern{Pattern: line, Source: path, Line: lineNumber})
 	}
 
 	return scanner.Err()
@@ -42,7 +73,15 @@ func (g *GitIgnore) Load(path string) error {
 
 // ShouldIgnore checks if a path should be ignored based on .gitignore patterns
 func (g *GitIgnore) ShouldIgnore(path string) bool {
-	for _, pattern := range g.patterns {
+	_, ignored := g.Match(path)
+	return ignored
+}
+
+// Match returns the first .gitignore pattern matching path
+func (g *GitIgnore) Match(path string) (IgnorePattern, bool) {
+	for _, rule := range g.patterns {
+		pattern := rule.Pattern
+
 		// Convert pattern to absolute path if it's relative
 		absPattern := pattern
 		if !filepath.IsAbs(pattern) {
@@ -52,13 +91,13 @@ func (g *GitIgnore) ShouldIgnore(path string) bool {
 		// Check if the path matches the pattern
 		matched, err := filepath.Match(absPattern, path)
 		if err == nil && matched {
-			return true
+			return rule, true
 		}
 
 		// Check if the path contains the pattern as a directory
 		if strings.Contains(path, pattern) {
-			return true
+			return rule, true
 		}
 	}
-	return false
+	return IgnorePattern{}, false
 }
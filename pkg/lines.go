@@ -0,0 +1,291 @@
+package pkg
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Line ending modes accepted by Config.EOL
+const (
+	EOLPreserve = "preserve" // Keep line endings exactly as they are in the source
+	EOLLF       = "lf"       // Normalize line endings to \n
+	EOLCRLF     = "crlf"     // Normalize line endings to \r\n
+)
+
+// readBufferSize is the chunk size used when reading file content.
+// Lines longer than this are streamed in several chunks instead of failing.
+const readBufferSize = 64 * 1024
+
+// ValidateEOL checks that mode is one of the supported line ending modes
+func ValidateEOL(mode string) error {
+	switch mode {
+	case "", EOLPreserve, EOLLF, EOLCRLF:
+		return nil
+	}
+	return fmt.Errorf("invalid line ending mode %q (expected %s, %s or %s)", mode, EOLLF, EOLCRLF, EOLPreserve)
+}
+
+// newline returns the line terminator used for headers and separators
+func newline(mode string) string {
+	if mode == EOLCRLF {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// LineRange is a range of lines of a file, numbered from 1 with both ends
+// included. An End of 0 means the end of the file, and the zero LineRange is
+// the whole file.
+type LineRange struct {
+	Start int
+	End   int
+}
+
+// ParseLineRange parses a range of lines: "120-200", "120-" up to the end of
+// the file, or "120" for a single line
+func ParseLineRange(s string) (LineRange, error) {
+	start, end, isRange := strings.Cut(s, "-")
+	r := LineRange{}
+	var err error
+	if r.Start, err = strconv.Atoi(start); err != nil || r.Start < 1 {
+		return LineRange{}, fmt.Errorf("invalid line range %q: expected START-END, START- or LINE, counting from 1", s)
+	}
+	switch {
+	case !isRange:
+		r.End = r.Start
+	case end != "":
+		if r.End, err = strconv.Atoi(end); err != nil || r.End < r.Start {
+			return LineRange{}, fmt.Errorf("invalid line range %q: the end must be a line number not before the start", s)
+		}
+	}
+	return r, nil
+}
+
+// IsZero reports whether r is the whole file
+func (r LineRange) IsZero() bool {
+	return r == LineRange{}
+}
+
+// String formats r as parsed by ParseLineRange
+func (r LineRange) String() string {
+	switch {
+	case r.IsZero():
+		return ""
+	case r.End == 0:
+		return fmt.Sprintf("%d-", r.Start)
+	}
+	return fmt.Sprintf("%d-%d", r.Start, r.End)
+}
+
+// lineRangeReader passes on the lines of r within a range and stops after
+// its last line. Lines are not buffered, so they can be of any length.
+type lineRangeReader struct {
+	r     io.Reader
+	lines LineRange
+	line  int   // Line of the next byte read
+	n     int64 // Bytes passed on
+	done  bool
+}
+
+func newLineRangeReader(r io.Reader, lines LineRange) *lineRangeReader {
+	return &lineRangeReader{r: r, lines: lines, line: 1}
+}
+
+func (l *lineRangeReader) Read(p []byte) (int, error) {
+	for {
+		if l.done {
+			return 0, io.EOF
+		}
+		n, err := l.r.Read(p)
+
+		// Keep the bytes of the lines in range, moving them to the front of p
+		kept := 0
+		for i := 0; i < n; i++ {
+			if l.line >= l.lines.Start {
+				p[kept] = p[i]
+				kept++
+			}
+			if p[i] == '\n' {
+				l.line++
+				if l.lines.End > 0 && l.line > l.lines.End {
+					l.done = true
+					break
+				}
+			}
+		}
+		l.n += int64(kept)
+		if kept > 0 || err != nil {
+			return kept, err
+		}
+	}
+}
+
+// copyResult describes what was written while copying file content
+type copyResult struct {
+	Lines           int  // Number of lines written (a final line without terminator counts)
+	CommentsRemoved int  // Number of lines dropped by the comment stripper
+	EndsWithNewline bool // Whether the written content ends with a line terminator
+	Empty           bool // Whether nothing was written at all
+}
+
+// copyContent streams src into dst. Without transforms the bytes are copied
+// verbatim; otherwise the content is processed line by line, where each line
+// may span any number of buffer-sized chunks.
+func copyContent(dst io.Writer, src io.Reader, stripComments bool, eol string) (copyResult, error) {
+	if eol == "" {
+		eol = EOLPreserve
+	}
+	if !stripComments && eol == EOLPreserve {
+		return copyVerbatim(dst, src)
+	}
+	return copyLines(dst, src, stripComments, eol)
+}
+
+// copyVerbatim copies src to dst without changing a single byte
+func copyVerbatim(dst io.Writer, src io.Reader) (copyResult, error) {
+	res := copyResult{Empty: true}
+	buf := make([]byte, readBufferSize)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			chunk := buf[:n]
+			res.Lines += bytes.Count(chunk, []byte{'\n'})
+			res.EndsWithNewline = chunk[n-1] == '\n'
+			res.Empty = false
+			if _, werr := dst.Write(chunk); werr != nil {
+				return res, werr
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return res, err
+		}
+	}
+	if !res.Empty && !res.EndsWithNewline {
+		res.Lines++
+	}
+	return res, nil
+}
+
+// copyLines copies src to dst line by line, applying comment stripping and
+// line ending normalization
+func copyLines(dst io.Writer, src io.Reader, stripComments bool, eol string) (copyResult, error) {
+	reader := bufio.NewReaderSize(src, readBufferSize)
+	w := &lineWriter{dst: dst, eol: eol, res: copyResult{Empty: true}}
+
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		if len(chunk) == 0 && err == io.EOF {
+			break
+		}
+		if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+			return w.res, err
+		}
+
+		// The first chunk of a line decides whether the whole line is a comment
+		skip := stripComments && IsLineComment(string(chunk))
+		if skip {
+			w.res.CommentsRemoved++
+		}
+
+		// Stream the remaining chunks of a line longer than the buffer
+		for {
+			if !skip {
+				if werr := w.write(chunk); werr != nil {
+					return w.res, werr
+				}
+			}
+			if !errors.Is(err, bufio.ErrBufferFull) {
+				break
+			}
+			chunk, err = reader.ReadSlice('\n')
+			if err != nil && err != io.EOF && !errors.Is(err, bufio.ErrBufferFull) {
+				return w.res, err
+			}
+		}
+
+		if !skip {
+			w.res.Lines++
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+
+	return w.res, w.flush()
+}
+
+// lineWriter writes line chunks, rewriting line terminators according to eol.
+// A carriage return at the end of a chunk is held back until the next chunk
+// shows whether it belongs to a \r\n terminator split across reads.
+type lineWriter struct {
+	dst       io.Writer
+	eol       string
+	pendingCR bool
+	res       copyResult
+}
+
+func (w *lineWriter) write(chunk []byte) error {
+	if len(chunk) == 0 {
+		return nil
+	}
+	w.res.Empty = false
+
+	hasNewline := chunk[len(chunk)-1] == '\n'
+	if !hasNewline {
+		if w.pendingCR {
+			if _, err := w.dst.Write([]byte{'\r'}); err != nil {
+				return err
+			}
+			w.pendingCR = false
+		}
+		if w.eol != EOLPreserve && chunk[len(chunk)-1] == '\r' {
+			chunk = chunk[:len(chunk)-1]
+			w.pendingCR = true
+		}
+		w.res.EndsWithNewline = false
+		_, err := w.dst.Write(chunk)
+		return err
+	}
+
+	body := chunk[:len(chunk)-1]
+	// A \r held back is the start of this terminator when nothing comes
+	// between them, and content otherwise
+	if w.pendingCR && len(body) > 0 {
+		if _, err := w.dst.Write([]byte{'\r'}); err != nil {
+			return err
+		}
+	}
+	w.pendingCR = false
+	if len(body) > 0 && body[len(body)-1] == '\r' {
+		body = body[:len(body)-1]
+	}
+
+	terminator := []byte(newline(w.eol))
+	if w.eol == EOLPreserve {
+		terminator = chunk[len(body):]
+	}
+	if _, err := w.dst.Write(body); err != nil {
+		return err
+	}
+	w.res.EndsWithNewline = true
+	_, err := w.dst.Write(terminator)
+	return err
+}
+
+// flush writes a carriage return still held back at the end of the content
+func (w *lineWriter) flush() error {
+	if !w.pendingCR {
+		return nil
+	}
+	w.pendingCR = false
+	_, err := w.dst.Write([]byte{'\r'})
+	return err
+}
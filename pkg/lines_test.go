@@ -0,0 +1,119 @@
+package pkg
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestCopyContent(t *testing.T) {
+	long := strings.Repeat("x", 2*readBufferSize+5)
+	// Lines whose terminator falls on the end of the read buffer
+	edge := strings.Repeat("x", readBufferSize-1)
+
+	tests := []struct {
+		name     string
+		src      string
+		lines    LineRange
+		strip    bool
+		eol      string
+		want     string
+		count    int
+		comments int
+	}{
+		{name: "preserve", src: "a\r\nb\nc\r", eol: EOLPreserve, want: "a\r\nb\nc\r", count: 3},
+		{name: "crlf to lf", src: "a\r\nb\r\n", eol: EOLLF, want: "a\nb\n", count: 2},
+		{name: "lf to crlf", src: "a\nb\r\n", eol: EOLCRLF, want: "a\r\nb\r\n", count: 2},
+		{name: "lone carriage return", src: "a\rb\n", eol: EOLLF, want: "a\rb\n", count: 1},
+		{name: "no final newline", src: "a\r\nb", eol: EOLLF, want: "a\nb", count: 2},
+		{name: "no final newline crlf", src: "a\nb", eol: EOLCRLF, want: "a\r\nb", count: 2},
+		{name: "final carriage return", src: "a\r", eol: EOLLF, want: "a\r", count: 1},
+		{name: "empty", src: "", eol: EOLLF, want: "", count: 0},
+		{name: "line longer than the buffer", src: long + "\r\ny\r\n", eol: EOLLF, want: long + "\ny\n", count: 2},
+		{name: "long line without newline", src: "y\n" + long, eol: EOLCRLF, want: "y\r\n" + long, count: 2},
+		{name: "crlf split across reads", src: edge + "\r\nb\r\n", eol: EOLLF, want: edge + "\nb\n", count: 2},
+		{name: "crlf split across reads to crlf", src: edge + "\r\nb\n", eol: EOLCRLF, want: edge + "\r\nb\r\n", count: 2},
+		{name: "carriage return at the end of a read", src: edge + "\rb\r\n", eol: EOLLF, want: edge + "\rb\n", count: 1},
+		{
+			name: "strip comments", src: "// a\r\nx\r\n  # b\ny", strip: true, eol: EOLPreserve,
+			want: "x\r\ny", count: 2, comments: 2,
+		},
+		{name: "range to lf", src: "1\r\n2\r\n3\r\n4\r\n", lines: LineRange{Start: 2, End: 3}, eol: EOLLF, want: "2\n3\n", count: 2},
+		{name: "range to crlf", src: "1\n2\n3\n", lines: LineRange{Start: 3, End: 3}, eol: EOLCRLF, want: "3\r\n", count: 1},
+		{name: "open range without final newline", src: "1\n2\n3", lines: LineRange{Start: 2}, eol: EOLCRLF, want: "2\r\n3", count: 2},
+		{name: "range past the end", src: "1\n2\n", lines: LineRange{Start: 5}, eol: EOLLF, want: "", count: 0},
+		{
+			name: "range with comments stripped", src: "1\n// c\r\n3\r\n4\r\n", lines: LineRange{Start: 2, End: 3},
+			strip: true, eol: EOLLF, want: "3\n", count: 1, comments: 1,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var src io.Reader = iotest.OneByteReader(strings.NewReader(tt.src))
+			if !tt.lines.IsZero() {
+				src = newLineRangeReader(src, tt.lines)
+			}
+			var out bytes.Buffer
+			res, err := copyContent(&out, src, tt.strip, tt.eol)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := out.String(); got != tt.want {
+				t.Errorf("output = %q, want %q", abbreviate(got), abbreviate(tt.want))
+			}
+			if res.Lines != tt.count || res.CommentsRemoved != tt.comments {
+				t.Errorf("lines = %d, comments = %d, want %d and %d", res.Lines, res.CommentsRemoved, tt.count, tt.comments)
+			}
+			if wantEnds := strings.HasSuffix(tt.want, "\n"); res.EndsWithNewline != wantEnds {
+				t.Errorf("EndsWithNewline = %v, want %v", res.EndsWithNewline, wantEnds)
+			}
+			if res.Empty != (tt.want == "") {
+				t.Errorf("Empty = %v for output %q", res.Empty, abbreviate(tt.want))
+			}
+		})
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	tests := []struct {
+		name   string
+		eol    string
+		chunks []string
+		want   string
+	}{
+		{"crlf split", EOLLF, []string{"a\r", "\n"}, "a\n"},
+		{"crlf split to crlf", EOLCRLF, []string{"a\r", "\n"}, "a\r\n"},
+		{"crlf split preserved", EOLPreserve, []string{"a\r", "\n"}, "a\r\n"},
+		{"lone carriage return", EOLLF, []string{"a\r", "b\n"}, "a\rb\n"},
+		{"carriage return before crlf", EOLLF, []string{"a\r", "b\r\n"}, "a\rb\n"},
+		{"two carriage returns", EOLLF, []string{"a\r", "\r", "\n"}, "a\r\n"},
+		{"held back at the end", EOLLF, []string{"a\r"}, "a\r"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out bytes.Buffer
+			w := &lineWriter{dst: &out, eol: tt.eol}
+			for _, chunk := range tt.chunks {
+				if err := w.write([]byte(chunk)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.flush(); err != nil {
+				t.Fatal(err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("output = %q, want %q", out.String(), tt.want)
+			}
+		})
+	}
+}
+
+// abbreviate shortens long test output to its ends
+func abbreviate(s string) string {
+	if len(s) <= 40 {
+		return s
+	}
+	return s[:20] + "..." + s[len(s)-20:]
+}
@@ -0,0 +1,177 @@
+package pkg
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/printer"
+	"go/token"
+	"io"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// Outliner produces the outline of a file from its content: its
+// declarations, signatures and doc comments with the bodies elided. An error
+// means the content can't be outlined, and it is then copied whole.
+type Outliner interface {
+	Outline(src []byte) ([]byte, error)
+}
+
+// OutlinerFunc adapts a function to Outliner
+type OutlinerFunc func(src []byte) ([]byte, error)
+
+func (f OutlinerFunc) Outline(src []byte) ([]byte, error) {
+	return f(src)
+}
+
+var (
+	outlinersMu sync.RWMutex
+	outliners   = map[string]Outliner{}
+)
+
+func init() {
+	RegisterOutliner(OutlinerFunc(outlineGo), ".go")
+	RegisterOutliner(OutlinerFunc(outlinePython), ".py", ".pyi")
+	RegisterOutliner(braceOutliner(jsLanguage), ".js", ".jsx", ".mjs", ".cjs", ".ts", ".tsx", ".mts", ".cts")
+	RegisterOutliner(braceOutliner(javaLanguage), ".java")
+	RegisterOutliner(braceOutliner(rustLanguage), ".rs")
+	RegisterOutliner(braceOutliner(cHeaderLanguage), ".h", ".hh", ".hpp", ".hxx")
+}
+
+// RegisterOutliner makes outliner the outliner of files with the given
+// extensions, like ".py", replacing the one registered before. The registry
+// is global: it applies to every run of the process.
+func RegisterOutliner(outliner Outliner, extensions ...string) {
+	outlinersMu.Lock()
+	defer outlinersMu.Unlock()
+	for _, ext := range extensions {
+		outliners[strings.ToLower(ext)] = outliner
+	}
+}
+
+// OutlinerFor returns the outliner of files with the extension ext
+func OutlinerFor(ext string) (Outliner, bool) {
+	outlinersMu.RLock()
+	defer outlinersMu.RUnlock()
+	outliner, ok := outliners[strings.ToLower(ext)]
+	return outliner, ok
+}
+
+// outlineContent replaces content with its outline when there is an
+// outliner for the extension of path, in outliners or else registered.
+// Content that can't be outlined, like a file that doesn't parse, is kept
+// whole. The lines of the original content are returned, as outlined reports
+// whether the content was replaced.
+func outlineContent(path string, content io.Reader, outliners map[string]Outliner) (out io.Reader, inputLines int, outlined bool, err error) {
+	ext := strings.ToLower(filepath.Ext(path))
+	outliner, ok := outliners[ext]
+	if !ok {
+		outliner, ok = OutlinerFor(ext)
+	}
+	if !ok {
+		return content, 0, false, nil
+	}
+	src, err := io.ReadAll(content)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	result, err := outliner.Outline(src)
+	if err != nil {
+		return bytes.NewReader(src), 0, false, nil
+	}
+	inputLines = bytes.Count(src, []byte("\n"))
+	if len(src) > 0 && src[len(src)-1] != '\n' {
+		inputLines++
+	}
+	return bytes.NewReader(result), inputLines, true, nil
+}
+
+// outlineGo keeps the package clause, the imports and the exported
+// declarations of a Go file, with their doc comments, and elides the bodies
+// of functions and methods
+func outlineGo(src []byte) ([]byte, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, "", src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	if file.Doc != nil {
+		buf.WriteString(commentText(file.Doc))
+	}
+	buf.WriteString("package " + file.Name.Name + "\n")
+
+	for _, decl := range file.Decls {
+		var start, end token.Pos
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if !decl.Name.IsExported() || (decl.Recv != nil && !ast.IsExported(receiverName(decl))) {
+				continue
+			}
+			decl.Body = nil
+			start, end = decl.Pos(), decl.Type.End()
+			if decl.Doc != nil {
+				start = decl.Doc.Pos()
+			}
+		case *ast.GenDecl:
+			if decl.Tok != token.IMPORT && !exportsName(decl) {
+				continue
+			}
+			start, end = decl.Pos(), decl.End()
+			if decl.Doc != nil {
+				start = decl.Doc.Pos()
+			}
+		default:
+			continue
+		}
+
+		// Only the comments of what is kept are printed
+		var comments []*ast.CommentGroup
+		for _, group := range file.Comments {
+			if group.Pos() >= start && group.End() <= end {
+				comments = append(comments, group)
+			}
+		}
+		buf.WriteString("\n")
+		if err := gofmtConfig.Fprint(&buf, fset, &printer.CommentedNode{Node: decl, Comments: comments}); err != nil {
+			return nil, err
+		}
+		buf.WriteString("\n")
+	}
+	return buf.Bytes(), nil
+}
+
+// gofmtConfig prints declarations the way gofmt does
+var gofmtConfig = printer.Config{Mode: printer.UseSpaces | printer.TabIndent, Tabwidth: 8}
+
+// exportsName reports whether a const, var or type declaration declares an
+// exported name. Groups are kept whole.
+func exportsName(decl *ast.GenDecl) bool {
+	for _, spec := range decl.Specs {
+		switch spec := spec.(type) {
+		case *ast.TypeSpec:
+			if spec.Name.IsExported() {
+				return true
+			}
+		case *ast.ValueSpec:
+			for _, name := range spec.Names {
+				if name.IsExported() {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// commentText returns the comment group as written, one comment per line
+func commentText(group *ast.CommentGroup) string {
+	var b strings.Builder
+	for _, comment := range group.List {
+		b.WriteString(comment.Text + "\n")
+	}
+	return b.String()
+}
@@ -0,0 +1,372 @@
+package pkg
+
+import (
+	"regexp"
+	"strings"
+)
+
+// Outliners of languages without a parser in the standard library. They work
+// line by line on the structure of the code, braces or indentation, so they
+// are heuristics: unusual formatting may keep a little more or less.
+
+// pythonDefinition matches the header of a function or class
+var pythonDefinition = regexp.MustCompile(`^(async\s+)?(def|class)\s+(\w+)`)
+
+// pythonAssignment matches an assignment or annotation, like a constant or a
+// class attribute
+var pythonAssignment = regexp.MustCompile(`^[A-Za-z_][\w.]*\s*(:\s*\S.*)?=[^=]|^[A-Za-z_]\w*\s*:\s*\S`)
+
+// pythonName matches the name a statement starts with
+var pythonName = regexp.MustCompile(`^[A-Za-z_]\w*`)
+
+// outlinePython keeps the imports, assignments, classes and the signatures of
+// the functions, with their comments, decorators and docstrings, and replaces
+// function bodies with "...". Names starting with a single underscore are
+// private and left out.
+func outlinePython(src []byte) ([]byte, error) {
+	lines := splitLines(src)
+	out := &outlineWriter{}
+	var pending []string
+	skipIndent := -1 // Lines indented deeper than this are an elided body
+	first := true    // The first statement may be the module docstring
+
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		indent := indentation(line)
+		if trimmed == "" {
+			out.blank = true
+			continue
+		}
+		if skipIndent >= 0 {
+			if indent > skipIndent {
+				continue
+			}
+			skipIndent = -1
+		}
+		if strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "@") {
+			pending = append(pending, line)
+			continue
+		}
+
+		end := pythonStatementEnd(lines, i)
+		statement := lines[i : end+1]
+		m := pythonDefinition.FindStringSubmatch(trimmed)
+		switch {
+		case m != nil && isPrivatePython(m[3]):
+			skipIndent = indent
+		case pythonAssignment.MatchString(trimmed) && isPrivatePython(pythonName.FindString(trimmed)):
+			// A private variable or attribute, left out
+		case m != nil:
+			out.write(pending...)
+			out.write(statement...)
+			// The docstring is the first statement of the body
+			body := end + 1
+			for body < len(lines) && strings.TrimSpace(lines[body]) == "" {
+				body++
+			}
+			bodyIndent := indent + 4
+			if body < len(lines) && indentation(lines[body]) > indent {
+				bodyIndent = indentation(lines[body])
+				if isDocstring(strings.TrimSpace(lines[body])) {
+					docEnd := pythonStatementEnd(lines, body)
+					out.write(lines[body : docEnd+1]...)
+					end = docEnd
+				}
+			}
+			if m[2] == "def" {
+				out.write(strings.Repeat(" ", bodyIndent) + "...")
+				skipIndent = indent
+			}
+		case first && isDocstring(trimmed),
+			strings.HasPrefix(trimmed, "import ") || strings.HasPrefix(trimmed, "from "),
+			pythonAssignment.MatchString(trimmed):
+			out.write(pending...)
+			out.write(statement...)
+		}
+		pending = nil
+		first = false
+		i = end
+	}
+	return out.bytes(), nil
+}
+
+// isPrivatePython reports whether a Python name is private by convention
+func isPrivatePython(name string) bool {
+	return strings.HasPrefix(name, "_") && !strings.HasSuffix(name, "__")
+}
+
+// isDocstring reports whether a trimmed line starts a string statement
+func isDocstring(trimmed string) bool {
+	trimmed = strings.TrimLeft(trimmed, "rRuUbBfF")
+	return strings.HasPrefix(trimmed, `"""`) || strings.HasPrefix(trimmed, "'''") ||
+		strings.HasPrefix(trimmed, `"`) || strings.HasPrefix(trimmed, "'")
+}
+
+// pythonStatementEnd returns the last line of the statement starting at line
+// i: it goes on while brackets or triple-quoted strings are open, or after a
+// line ending in a backslash
+func pythonStatementEnd(lines []string, i int) int {
+	depth, quotes := 0, 0
+	for j := i; j < len(lines); j++ {
+		line := lines[j]
+		quotes += strings.Count(line, `"""`) + strings.Count(line, "'''")
+		if quotes%2 == 0 {
+			code := stringLiteral.ReplaceAllString(line, "")
+			if k := strings.Index(code, "#"); k >= 0 {
+				code = code[:k]
+			}
+			depth += strings.Count(code, "(") + strings.Count(code, "[") + strings.Count(code, "{")
+			depth -= strings.Count(code, ")") + strings.Count(code, "]") + strings.Count(code, "}")
+		}
+		if depth <= 0 && quotes%2 == 0 && !strings.HasSuffix(strings.TrimRight(line, " \t"), `\`) {
+			return j
+		}
+	}
+	return len(lines) - 1
+}
+
+// braceLanguage describes a language whose blocks are delimited by braces
+type braceLanguage struct {
+	// typeKeywords introduce blocks whose members are kept, like classes;
+	// other blocks, like function bodies, are elided
+	typeKeywords []string
+
+	// declKeywords start the top-level statements that are kept
+	declKeywords []string
+
+	// keepTopLevel keeps every top-level statement, for headers that hold
+	// declarations only
+	keepTopLevel bool
+}
+
+var (
+	jsLanguage = braceLanguage{
+		typeKeywords: []string{"class", "interface", "enum", "namespace", "module"},
+		declKeywords: []string{"import", "export", "function", "async", "class", "interface", "type", "enum",
+			"const", "let", "var", "declare", "namespace", "abstract", "module.exports", "exports"},
+	}
+	javaLanguage = braceLanguage{
+		typeKeywords: []string{"class", "interface", "enum", "record", "@interface"},
+		declKeywords: []string{"package", "import", "public", "protected", "private", "class", "interface", "enum",
+			"record", "abstract", "final", "sealed", "non-sealed", "static", "@interface"},
+	}
+	rustLanguage = braceLanguage{
+		typeKeywords: []string{"struct", "enum", "union", "trait", "impl", "mod"},
+		declKeywords: []string{"use", "mod", "pub", "pub(crate)", "fn", "struct", "enum", "union", "trait", "impl",
+			"type", "const", "static", "extern", "unsafe", "async", "macro_rules!"},
+	}
+	cHeaderLanguage = braceLanguage{
+		typeKeywords: []string{"struct", "union", "enum", "class", "namespace", "extern"},
+		keepTopLevel: true,
+	}
+)
+
+// braceOutliner returns the outliner of a brace language. It keeps the
+// top-level declarations and the members of types, with the comments and
+// annotations directly above them, and replaces the other blocks, such as
+// function bodies, with "{ ... }".
+func braceOutliner(lang braceLanguage) Outliner {
+	return OutlinerFunc(func(src []byte) ([]byte, error) {
+		lines := splitLines(src)
+		out := &outlineWriter{}
+		var pending []string
+		var types []int // Brace depth inside each open type block
+		depth := 0
+		inComment := false
+
+		for i := 0; i < len(lines); i++ {
+			line := lines[i]
+			trimmed := strings.TrimSpace(line)
+
+			// Comments and annotations are kept if a kept statement follows
+			if inComment {
+				pending = append(pending, line)
+				inComment = !strings.Contains(trimmed, "*/")
+				continue
+			}
+			switch {
+			case trimmed == "":
+				out.blank = true
+				pending = nil
+				continue
+			case strings.HasPrefix(trimmed, "//!"):
+				// Rust inner doc comments document the enclosing module
+				out.write(line)
+				continue
+			case strings.HasPrefix(trimmed, "/*"):
+				pending = append(pending, line)
+				inComment = !strings.Contains(trimmed, "*/")
+				continue
+			case strings.HasPrefix(trimmed, "//"), strings.HasPrefix(trimmed, "#["), strings.HasPrefix(trimmed, "#!["),
+				strings.HasPrefix(trimmed, "@") && !strings.HasPrefix(trimmed, "@interface"):
+				pending = append(pending, line)
+				continue
+			}
+
+			// The end of a type block
+			if len(types) > 0 && strings.HasPrefix(trimmed, "}") && depth+braceBalance(line) < types[len(types)-1] {
+				out.write(line)
+				depth += braceBalance(line)
+				types = types[:len(types)-1]
+				pending = nil
+				continue
+			}
+
+			// A statement goes on while its parentheses are open
+			end := i
+			parens := parenBalance(line)
+			for parens > 0 && end+1 < len(lines) {
+				end++
+				parens += parenBalance(lines[end])
+			}
+			statement := lines[i : end+1]
+			opened := 0
+			for _, l := range statement {
+				opened += braceBalance(l)
+			}
+			header := strings.TrimSpace(strings.Join(statement, " "))
+
+			keep := len(types) > 0 || lang.keepTopLevel || hasKeyword(header, lang.declKeywords) ||
+				strings.HasPrefix(header, "#")
+			switch {
+			case !keep:
+				// Left out, with its block
+			case opened > 0 && hasWord(header[:strings.Index(header, "{")+1], lang.typeKeywords):
+				out.write(pending...)
+				out.write(statement...)
+				types = append(types, depth+opened)
+			case opened > 0:
+				// The statement is cut after the last brace it opens, which
+				// may be on an earlier line than its last one
+				open := len(statement) - 1
+				for open > 0 && !strings.Contains(stripStrings(statement[open]), "{") {
+					open--
+				}
+				out.write(pending...)
+				out.write(statement[:open]...)
+				if k := lastBrace(statement[open]); k >= 0 {
+					out.write(statement[open][:k+1] + " ... }")
+				} else {
+					out.write(statement[open:]...)
+				}
+			default:
+				out.write(pending...)
+				out.write(statement...)
+			}
+			pending = nil
+			depth += opened
+			i = end
+
+			// Skip the rest of an elided block
+			if opened > 0 && (len(types) == 0 || types[len(types)-1] != depth) {
+				target := depth - opened
+				for depth > target && i+1 < len(lines) {
+					i++
+					depth += braceBalance(lines[i])
+				}
+			}
+		}
+		return out.bytes(), nil
+	})
+}
+
+// braceBalance returns the braces opened minus those closed on a line,
+// ignoring string literals and line comments
+func braceBalance(line string) int {
+	code := stripStrings(line)
+	return strings.Count(code, "{") - strings.Count(code, "}")
+}
+
+// lastBrace returns the index of the last "{" of line counted by
+// braceBalance, outside string literals and a line comment, or -1
+func lastBrace(line string) int {
+	literals := stringLiteral.FindAllStringIndex(line, -1)
+	last := -1
+	for i := 0; i < len(line); i++ {
+		if len(literals) > 0 && i == literals[0][0] {
+			i = literals[0][1] - 1
+			literals = literals[1:]
+			continue
+		}
+		if strings.HasPrefix(line[i:], "//") {
+			break
+		}
+		if line[i] == '{' {
+			last = i
+		}
+	}
+	return last
+}
+
+// parenBalance returns the parentheses opened minus those closed on a line
+func parenBalance(line string) int {
+	code := stripStrings(line)
+	return strings.Count(code, "(") - strings.Count(code, ")")
+}
+
+// hasKeyword reports whether statement starts with one of keywords
+func hasKeyword(statement string, keywords []string) bool {
+	for _, keyword := range keywords {
+		if rest, ok := strings.CutPrefix(statement, keyword); ok && (rest == "" || !isWordChar(rest[0])) {
+			return true
+		}
+	}
+	return false
+}
+
+// hasWord reports whether text contains one of words as a whole word
+func hasWord(text string, words []string) bool {
+	for _, word := range words {
+		for i := strings.Index(text, word); i >= 0; {
+			end := i + len(word)
+			if (i == 0 || !isWordChar(text[i-1])) && (end == len(text) || !isWordChar(text[end])) {
+				return true
+			}
+			next := strings.Index(text[i+1:], word)
+			if next < 0 {
+				break
+			}
+			i += next + 1
+		}
+	}
+	return false
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9'
+}
+
+// splitLines splits src into lines without their terminators
+func splitLines(src []byte) []string {
+	text := strings.TrimSuffix(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// outlineWriter collects the lines of an outline, keeping a single blank line
+// where the source had blank lines between kept lines
+type outlineWriter struct {
+	lines []string
+	blank bool
+}
+
+func (w *outlineWriter) write(lines ...string) {
+	if len(lines) == 0 {
+		return
+	}
+	if w.blank && len(w.lines) > 0 {
+		w.lines = append(w.lines, "")
+	}
+	w.blank = false
+	w.lines = append(w.lines, lines...)
+}
+
+func (w *outlineWriter) bytes() []byte {
+	if len(w.lines) == 0 {
+		return nil
+	}
+	return []byte(strings.Join(w.lines, "\n") + "\n")
+}
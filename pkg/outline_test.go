@@ -0,0 +1,111 @@
+package pkg
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// update rewrites the golden files with the outlines produced
+var update = flag.Bool("update", false, "rewrite the golden files of testdata")
+
+// TestOutlineGolden outlines each file of testdata/outline with the outliner
+// of its extension and compares the result with the file of the same name
+// ending in ".golden"
+func TestOutlineGolden(t *testing.T) {
+	inputs, err := filepath.Glob(filepath.Join("testdata", "outline", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, input := range inputs {
+		if strings.HasSuffix(input, ".golden") {
+			continue
+		}
+		t.Run(filepath.Base(input), func(t *testing.T) {
+			outliner, ok := OutlinerFor(filepath.Ext(input))
+			if !ok {
+				t.Fatalf("no outliner for %s", filepath.Ext(input))
+			}
+			src, err := os.ReadFile(input)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := outliner.Outline(src)
+			if err != nil {
+				t.Fatalf("Outline: %v", err)
+			}
+
+			golden := input + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, got, 0o644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != string(want) {
+				t.Errorf("outline of %s:\n%s\nwant:\n%s", input, got, want)
+			}
+		})
+	}
+}
+
+// TestBraceOutlinerCut checks where elided blocks are cut: after the brace
+// that opens them, wherever the statement ends
+func TestBraceOutlinerCut(t *testing.T) {
+	tests := []struct {
+		name string
+		ext  string
+		src  string
+		want string
+	}{
+		{
+			// The brace opens on the first line, the parentheses close later
+			name: "object literal with a call",
+			ext:  ".ts",
+			src:  "const z = { a: foo(\n 1), b: 2,\n c: 3 };\nconst after = 1;\n",
+			want: "const z = { ... }\nconst after = 1;\n",
+		},
+		{
+			name: "multi-line parameters",
+			ext:  ".ts",
+			src:  "export function f(\n  a: string,\n  b: number,\n): void {\n  return;\n}\n",
+			want: "export function f(\n  a: string,\n  b: number,\n): void { ... }\n",
+		},
+		{
+			name: "brace on its own line",
+			ext:  ".java",
+			src:  "public class A {\n    public void run(int a,\n            int b)\n    {\n        go();\n    }\n}\n",
+			want: "public class A {\n    public void run(int a,\n            int b)\n    { ... }\n}\n",
+		},
+		{
+			name: "balanced on one line",
+			ext:  ".js",
+			src:  "function g() { return \"}\"; }\n",
+			want: "function g() { return \"}\"; }\n",
+		},
+		{
+			name: "brace in a string",
+			ext:  ".js",
+			src:  "function h(s = \"}\") {\n  return s;\n}\nconst x = 1;\n",
+			want: "function h(s = \"}\") { ... }\nconst x = 1;\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			outliner, _ := OutlinerFor(tt.ext)
+			got, err := outliner.Outline([]byte(tt.src))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("outline:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
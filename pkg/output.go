@@ -0,0 +1,84 @@
+package pkg
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// OutputFile writes to a temporary file that replaces the destination only
+// when committed, so an interrupted run never leaves a truncated file behind.
+// Paths ending in .gz are gzip-compressed.
+type OutputFile struct {
+	path   string
+	tmp    *os.File
+	buf    *bufio.Writer
+	gz     *gzip.Writer
+	closed bool
+}
+
+// CreateOutputFile prepares an atomic write to path
+func CreateOutputFile(path string) (*OutputFile, error) {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("error creating output file: %v", err)
+	}
+
+	f := &OutputFile{path: path, tmp: tmp}
+	if strings.HasSuffix(strings.ToLower(path), ".gz") {
+		f.gz = gzip.NewWriter(tmp)
+		f.buf = bufio.NewWriter(f.gz)
+	} else {
+		f.buf = bufio.NewWriter(tmp)
+	}
+	return f, nil
+}
+
+// Write writes p to the temporary file
+func (f *OutputFile) Write(p []byte) (int, error) {
+	return f.buf.Write(p)
+}
+
+// Commit flushes the content and moves the temporary file to its destination
+func (f *OutputFile) Commit() error {
+	if f.closed {
+		return fmt.Errorf("output file %s already closed", f.path)
+	}
+	f.closed = true
+
+	err := f.buf.Flush()
+	if err == nil && f.gz != nil {
+		err = f.gz.Close()
+	}
+	if err == nil {
+		err = f.tmp.Chmod(0644)
+	}
+	if err == nil {
+		err = f.tmp.Sync()
+	}
+	if closeErr := f.tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(f.tmp.Name(), f.path)
+	}
+	if err != nil {
+		os.Remove(f.tmp.Name())
+		return fmt.Errorf("error writing output file: %v", err)
+	}
+	return nil
+}
+
+// Abort discards the temporary file, leaving the destination untouched
+func (f *OutputFile) Abort() error {
+	if f.closed {
+		return nil
+	}
+	f.closed = true
+	f.tmp.Close()
+	return os.Remove(f.tmp.Name())
+}
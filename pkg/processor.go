@@ -1,24 +1,55 @@
 package pkg
 
 import (
-	"bufio"
+	"context"
+	"errors"
 	"fmt"
+	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strings"
+	"syscall"
+	"time"
 )
 
 // file: /Users/jackson/workspace/meus_projetos/scopy/pkg/processor.go
 // Config contains the settings for file processing
 type Config struct {
 	HeaderFormat    string
+	HeaderPrefix    string // Prepended to the paths in headers, e.g. the revision the files are read at
 	ExcludePatterns []string
+	ExcludeSource   string // Where ExcludePatterns come from, as reported by Explain (default: "--exclude")
 	MaxSize         int64
 	StripComments   bool
+	Outline         bool                // Copy the outline of the files of languages with an outliner
+	Outliners       map[string]Outliner // Outliners of this run by extension, like ".md", before the registered ones
 	Extensions      []string
-	OutputToMemory  bool
-	IncludeDotFiles bool // Incluir arquivos que começam com ponto (.)
-	FollowSymlinks  bool // Seguir links simbólicos
+	Output          io.Writer // Destination of the generated content (default: os.Stdout)
+	OutputPath      string    // File receiving the content, never included in it
+	IncludeDotFiles bool      // Incluir arquivos que começam com ponto (.)
+	FollowSymlinks  bool      // Seguir links simbólicos
+	SymlinkPath     string    // Path shown for files reached through links: SymlinkPathLink (default) or SymlinkPathTarget
+	StayInRoot      bool      // Skip symbolic links whose target is outside the base directory
+	EOL             string    // Line ending mode: EOLPreserve (default), EOLLF or EOLCRLF
+	FailOnEmpty     bool      // Return ErrNothingMatched when no file is selected
+	Strict          bool      // Stop at the first unreadable file instead of skipping it
+	ListOnly        bool      // Collect the selected files as entries instead of writing their content
+	ListDetails     bool      // In list mode, count the lines and tokens of each file
+	ListRejected    bool      // Also collect entries for candidates rejected by a filter
+
+	// Hooks called during the walk: OnFile after each file is copied, where
+	// an error stops the run, and OnSkip for each file with a requested
+	// extension that another filter leaves out
+	OnFile func(FileStat) error
+	OnSkip func(Entry)
+
+	// Progress, when set, is told about the progress after each file
+	Progress ProgressReporter
+
+	// FallbackEncoding is the charset assumed for content that is neither
+	// UTF-8 nor UTF-16 (default: DefaultFallbackEncoding)
+	FallbackEncoding string
 }
 
 // Processor is responsible for processing files
@@ -26,245 +57,488 @@ type Processor struct {
 	config    Config
 	stats     Stats
 	gitIgnore *GitIgnore
-	output    strings.Builder
+	output    *outputWriter
+
+	entries []Entry
+
+	// The tree walked and read: the base directory, the tree of ProcessFS,
+	// or the directory of a named file
+	fsys fs.FS
+	ctx  context.Context
+
+	start    time.Time
+	progress Progress
+
+	// Symbolic links, resolved on disk only: the base directory, empty for
+	// the tree of ProcessFS, its real path, the identity of each selected
+	// file with the path it was selected under, and the directories already
+	// walked
+	root        string
+	realRoot    string
+	seen        map[fileID]string
+	visitedDirs map[fileID]bool
+
+	// State of the last file written, to separate it from the next one
+	filesWritten    int
+	lastEndsNewline bool
 }
 
-// Stats contains the processing statistics
-type Stats struct {
-	TotalFiles      int
-	FilesByExt      map[string]int
-	TotalBytes      int64
-	TotalLines      int
-	CommentsRemoved int
+// outputWriter wraps the output to tell write failures, which always stop
+// processing, apart from read failures
+type outputWriter struct {
+	w   io.Writer
+	err error
+}
+
+func (o *outputWriter) Write(b []byte) (int, error) {
+	n, err := o.w.Write(b)
+	if err != nil && o.err == nil {
+		o.err = err
+	}
+	return n, err
+}
+
+// FileError records a file that could not be read
+type FileError struct {
+	Path string
+	Err  error
+}
+
+func (e FileError) Error() string {
+	// Avoid repeating the path already carried by the underlying error
+	var pathErr *fs.PathError
+	if errors.As(e.Err, &pathErr) && pathErr.Path == e.Path {
+		return fmt.Sprintf("%s: %v", e.Path, pathErr.Err)
+	}
+	return fmt.Sprintf("%s: %v", e.Path, e.Err)
+}
+
+func (e FileError) Unwrap() error {
+	return e.Err
 }
 
 // NewProcessor creates a new Processor instance
 func NewProcessor(config Config) *Processor {
+	output := config.Output
+	if output == nil {
+		output = os.Stdout
+	}
 	return &Processor{
-		config:    config,
-		stats:     Stats{FilesByExt: make(map[string]int)},
-		gitIgnore: NewGitIgnore(),
-		output:    strings.Builder{},
+		config:      config,
+		stats:       Stats{ListOnly: config.ListOnly, FilesByExt: make(map[string]int), Skipped: make(map[SkipReason]int)},
+		gitIgnore:   NewGitIgnore(),
+		output:      &outputWriter{w: output},
+		ctx:         context.Background(),
+		seen:        make(map[fileID]string),
+		visitedDirs: make(map[fileID]bool),
 	}
 }
 
-// Process starts the file processing
+// Process starts the file processing. Unreadable files are skipped and
+// reported with a KindPartial error once all other files are written, unless
+// Strict is set. Other errors are of kind KindIO, except ErrNothingMatched
+// when FailOnEmpty is set and no file was selected.
 func (p *Processor) Process(baseDir string) error {
-	// Try to load .gitignore
-	gitIgnorePath := filepath.Join(baseDir, ".gitignore")
-	if _, err := os.Stat(gitIgnorePath); err == nil {
-		if err := p.gitIgnore.Load(gitIgnorePath); err != nil {
-			return fmt.Errorf("error loading .gitignore: %v", err)
-		}
-	}
-
-	// Reset total lines count before processing
-	p.stats.TotalLines = 0
+	return p.ProcessContext(context.Background(), baseDir)
+}
 
-	// First, count total files to track the last file
-	totalFiles := 0
-	fileCounter := 0
+// ProcessContext is Process stopping once ctx is done, with an error of
+// kind KindCanceled
+func (p *Processor) ProcessContext(ctx context.Context, baseDir string) error {
+	return p.run(ctx, func(q *Processor) error {
+		return q.walk(os.DirFS(baseDir), baseDir)
+	})
+}
 
-	// Configuração para a caminhada no sistema de arquivos
-	walkFunc := func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			// Se não seguimos links simbólicos e este for um erro de link simbólico, ignore
-			if !p.config.FollowSymlinks && os.IsNotExist(err) {
-				return nil
-			}
-			return err
-		}
+// ProcessFS processes the files of fsys, from its root, like ProcessContext.
+// The paths are those of fsys. Symbolic links are not resolved, so
+// FollowSymlinks, SymlinkPath and StayInRoot don't apply, and neither does
+// OutputPath.
+func (p *Processor) ProcessFS(ctx context.Context, fsys fs.FS) error {
+	return p.run(ctx, func(q *Processor) error {
+		return q.walk(fsys, "")
+	})
+}
 
-		// Se for um diretório, verifique se deve ser ignorado
-		if info.IsDir() {
-			// Ignora diretórios que começam com . a menos que includeDotFiles esteja ativado
-			baseName := filepath.Base(path)
-			if !p.config.IncludeDotFiles && strings.HasPrefix(baseName, ".") && path != "." {
-				return filepath.SkipDir
-			}
-			return nil
-		}
+// FileSpec names a file to copy, optionally limited to a range of lines
+type FileSpec struct {
+	Path   string
+	Lines  LineRange
+	Symbol string // Symbol declared in Lines, for the header
+}
 
-		// Ignora arquivos que começam com . a menos que includeDotFiles esteja ativado
-		baseName := filepath.Base(path)
-		if !p.config.IncludeDotFiles && strings.HasPrefix(baseName, ".") {
-			return nil
-		}
+// String formats the file as "path", "path:start-end" or, for a symbol,
+// "path:start-end (symbol)"
+func (f FileSpec) String() string {
+	name := f.Path
+	if !f.Lines.IsZero() {
+		name += ":" + f.Lines.String()
+	}
+	if f.Symbol != "" {
+		name += " (" + f.Symbol + ")"
+	}
+	return name
+}
 
-		// Skip files that should be excluded
-		if p.gitIgnore.ShouldIgnore(path) || p.shouldExclude(path) {
-			return nil
-		}
+// ProcessFiles copies files, relative to the current directory, in the given
+// order, like ProcessContext. The files were chosen by name, so the selection
+// filters don't apply; a file or range named twice is copied once. The
+// header of a range names it as "path:start-end".
+func (p *Processor) ProcessFiles(ctx context.Context, files []FileSpec) error {
+	return p.run(ctx, func(q *Processor) error {
+		return q.walkFiles(files)
+	})
+}
 
-		// Check file extension
-		ext := strings.ToLower(filepath.Ext(path))
-		if !p.hasValidExtension(ext) {
-			return nil
+// run walks the files with walk, which is also given the processor of the
+// scan estimating the progress
+func (p *Processor) run(ctx context.Context, walk func(*Processor) error) error {
+	p.ctx = ctx
+	p.start = time.Now()
+	err := p.runWalk(walk)
+	p.stats.Elapsed = time.Since(p.start)
+	if p.config.Progress != nil {
+		p.progress.Done = true
+		p.reportProgress(p.progress.Path)
+	}
+	if err != nil {
+		if ctxErr := ctx.Err(); ctxErr != nil && errors.Is(err, ctxErr) {
+			return NewError(KindCanceled, err)
 		}
+		return NewError(KindIO, err)
+	}
+	if n := len(p.stats.Errors); n > 0 {
+		return &Error{Kind: KindPartial, Err: fmt.Errorf("%d file(s) could not be processed", n)}
+	}
+	if p.config.FailOnEmpty && p.stats.TotalFiles == 0 {
+		return ErrNothingMatched
+	}
+	return nil
+}
 
-		// Check maximum size
-		if p.config.MaxSize > 0 && info.Size() > p.config.MaxSize {
-			return nil
+func (p *Processor) runWalk(walk func(*Processor) error) error {
+	if p.config.Progress != nil && !p.config.ListOnly {
+		if err := p.estimate(p.ctx, walk); err != nil {
+			return err
 		}
+	}
+	return walk(p)
+}
 
-		totalFiles++
+// loadGitIgnore loads the .gitignore file at the root of p.fsys, if there is
+// one
+func (p *Processor) loadGitIgnore() error {
+	if _, err := fs.Stat(p.fsys, ".gitignore"); err != nil {
 		return nil
 	}
+	file, err := p.fsys.Open(".gitignore")
+	if err != nil {
+		return fmt.Errorf("error loading .gitignore: %v", err)
+	}
+	defer file.Close()
+	if err := p.gitIgnore.read(file, p.shownPath(".gitignore")); err != nil {
+		return fmt.Errorf("error loading .gitignore: %v", err)
+	}
+	return nil
+}
 
-	// Primeira passagem: contagem de arquivos elegíveis
-	if p.config.FollowSymlinks {
-		err := filepath.Walk(baseDir, func(path string, info os.FileInfo, err error) error {
-			// Implementação personalizada para seguir links simbólicos
-			if err != nil {
-				return err
-			}
-
-			// Se for um link simbólico
-			if info.Mode()&os.ModeSymlink != 0 {
-				// Resolve o link simbólico
-				realPath, err := os.Readlink(path)
-				if err != nil {
-					return nil // Ignora erro ao ler o link
-				}
-
-				// Se for um caminho relativo, torna-o absoluto
-				if !filepath.IsAbs(realPath) {
-					realPath = filepath.Join(filepath.Dir(path), realPath)
-				}
-
-				// Obtém informações sobre o destino do link
-				destInfo, err := os.Stat(realPath)
-				if err != nil {
-					return nil // Ignora erro ao acessar o destino do link
-				}
+// walk walks fsys from its root. dir is the directory of fsys on disk, or
+// empty for other trees: symbolic links are only resolved on disk.
+func (p *Processor) walk(fsys fs.FS, dir string) error {
+	p.fsys = fsys
+	p.root = dir
+	if dir != "" {
+		// Symbolic links are resolved against the real root directory
+		p.realRoot = dir
+		if real, err := realPath(dir); err == nil {
+			p.realRoot = real
+		}
+	}
 
-				// Se o destino for um diretório, processa-o recursivamente
-				if destInfo.IsDir() {
-					return filepath.Walk(realPath, walkFunc)
-				}
+	// Try to load .gitignore
+	if err := p.loadGitIgnore(); err != nil {
+		return err
+	}
+	return p.walkDir(".")
+}
 
-				// Se for um arquivo, processa-o normalmente usando o destino do link
-				return walkFunc(realPath, destInfo, nil)
-			}
+// shownPath returns the path a file of p.fsys is reported under: its path on
+// disk, under the base directory as given, or its name in other trees
+func (p *Processor) shownPath(name string) string {
+	if p.root == "" {
+		return name
+	}
+	return filepath.Join(p.root, filepath.FromSlash(name))
+}
 
-			// Para arquivos e diretórios normais, usa a função de caminhada padrão
-			return walkFunc(path, info, err)
-		})
-		if err != nil {
-			return err
-		}
-	} else {
-		err := filepath.Walk(baseDir, walkFunc)
-		if err != nil {
-			return err
+// walkDir walks the directory root of p.fsys: its root, or a followed link
+// to a directory
+func (p *Processor) walkDir(root string) error {
+	onDisk := p.root != ""
+	return fs.WalkDir(p.fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if ctxErr := p.ctx.Err(); ctxErr != nil {
+			return ctxErr
 		}
-	}
 
-	// Segunda passagem: processamento de arquivos
-	processFunc := func(path string, info os.FileInfo, err error) error {
+		// The path of the file on disk, through the links followed
+		shown := p.shownPath(name)
 		if err != nil {
+			// Failing to read the base directory itself is never skipped
+			if name == "." {
+				return err
+			}
 			// Se não seguimos links simbólicos e este for um erro de link simbólico, ignore
-			if !p.config.FollowSymlinks && os.IsNotExist(err) {
+			if onDisk && !p.config.FollowSymlinks && errors.Is(err, fs.ErrNotExist) {
 				return nil
 			}
-			return err
+			return p.fileError(shown, err)
 		}
 
 		// Ignora diretórios
-		if info.IsDir() {
-			// Ignora diretórios que começam com . a menos que includeDotFiles esteja ativado
-			baseName := filepath.Base(path)
-			if !p.config.IncludeDotFiles && strings.HasPrefix(baseName, ".") && path != "." {
-				return filepath.SkipDir
+		if d.IsDir() {
+			if name != root && p.skipDir(shown) {
+				return fs.SkipDir
+			}
+			// Each real directory is walked once, whatever links lead to it
+			if info, err := d.Info(); onDisk && err == nil {
+				if id, ok := fileIdentity(shown, info); ok {
+					if p.visitedDirs[id] && name != root {
+						return fs.SkipDir
+					}
+					p.visitedDirs[id] = true
+				}
 			}
 			return nil
 		}
 
-		// Ignora arquivos que começam com . a menos que includeDotFiles esteja ativado
-		baseName := filepath.Base(path)
-		if !p.config.IncludeDotFiles && strings.HasPrefix(baseName, ".") {
-			return nil
+		info, err := d.Info()
+		if err != nil {
+			return p.fileError(shown, err)
+		}
+		if !onDisk {
+			return p.processEntry(shown, name, name, info, false)
+		}
+		if info.Mode()&fs.ModeSymlink != 0 {
+			return p.walkLink(name, shown, info)
 		}
 
-		// Check if file should be excluded by .gitignore
-		if p.gitIgnore.ShouldIgnore(path) {
-			return nil
+		// Files under a followed link are identified by their real path
+		real := shown
+		if root != "." {
+			if r, err := realPath(shown); err == nil {
+				real = r
+			}
 		}
+		return p.processEntry(shown, name, real, info, root != ".")
+	})
+}
 
-		// Check if file should be excluded by patterns
-		if p.shouldExclude(path) {
+// walkLink handles the symbolic link name of a tree on disk, found at shown:
+// a link to a file is processed as the file, and a link to a directory is
+// walked when following links
+func (p *Processor) walkLink(name, shown string, info fs.FileInfo) error {
+	target, err := os.Stat(shown)
+	if err != nil {
+		// Links leading back to themselves never resolve
+		if errors.Is(err, syscall.ELOOP) {
+			p.skip(shown, info, SkipCycle, shown)
 			return nil
 		}
+		if p.config.FollowSymlinks {
+			return p.fileError(shown, err)
+		}
+		// A broken link fails when it is read, if it is selected
+		return p.processEntry(shown, name, shown, info, true)
+	}
+	real, err := realPath(shown)
+	if err != nil {
+		return p.fileError(shown, err)
+	}
+	if p.config.StayInRoot && !p.inRoot(real) {
+		p.skip(shown, target, SkipOutsideRoot, real)
+		return nil
+	}
 
-		// Check file extension
-		ext := strings.ToLower(filepath.Ext(path))
-		if !p.hasValidExtension(ext) {
+	// Links to directories are only entered when following links
+	if target.IsDir() {
+		if !p.config.FollowSymlinks || p.skipDir(shown) {
 			return nil
 		}
-
-		// Check maximum size
-		if p.config.MaxSize > 0 && info.Size() > p.config.MaxSize {
+		// A directory of the tree is walked under its own path, so links
+		// only lead into directories outside it
+		own := p.displayPath(real)
+		walked := p.inRoot(real) && !p.skipDir(own) && !p.inSkippedDir(own)
+		if id, ok := fileIdentity(real, target); ok && p.visitedDirs[id] || walked {
+			reason := SkipDuplicate
+			if p.isAncestor(real, shown) {
+				reason = SkipCycle
+			}
+			p.skip(shown, target, reason, own)
 			return nil
 		}
+		return p.walkDir(name)
+	}
+	return p.processEntry(shown, name, real, target, true)
+}
 
-		// Update statistics
-		p.stats.TotalFiles++
-		p.stats.FilesByExt[ext]++
-		p.stats.TotalBytes += info.Size()
+// walkFiles copies the files named by files
+func (p *Processor) walkFiles(files []FileSpec) error {
+	p.root = "."
+	p.realRoot = "."
+	if real, err := realPath("."); err == nil {
+		p.realRoot = real
+	}
 
-		// Process file
-		fileCounter++
-		isLastFile := fileCounter == totalFiles
-		if err := p.processFile(path, isLastFile); err != nil {
+	named := make(map[string]string)
+	for _, spec := range files {
+		if err := p.ctx.Err(); err != nil {
 			return err
 		}
+		path := filepath.Clean(spec.Path)
+		info, err := os.Stat(path)
+		if err == nil && info.IsDir() {
+			err = fmt.Errorf("%s is a directory", path)
+		}
+		if err != nil {
+			if err := p.fileError(path, err); err != nil {
+				return err
+			}
+			continue
+		}
+		real := path
+		if r, err := realPath(path); err == nil {
+			real = r
+		}
 
+		// A file or range named twice, directly or through a link, is
+		// copied once; hard links are different names and both copied
+		p.progress.Scanned++
+		key := FileSpec{Path: real, Lines: spec.Lines}.String()
+		if first, ok := named[key]; ok {
+			p.skip(path, info, SkipDuplicate, first)
+			p.reportProgress(path)
+			continue
+		}
+		named[key] = spec.String()
+		// Named files may be outside the current directory, so each one is
+		// read from its own directory
+		p.fsys = os.DirFS(filepath.Dir(path))
+		err = p.copyEntry(path, filepath.Base(path), real, info, spec)
+		p.reportProgress(path)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// processEntry selects and copies a file. shown is its path in the tree,
+// path the path it is read from and real the path of the file it resolves to;
+// link tells whether shown goes through a link.
+func (p *Processor) processEntry(shown, path, real string, info os.FileInfo, link bool) error {
+	p.progress.Scanned++
+	defer p.reportProgress(shown)
+
+	if reason, detail := p.selectFile(shown, info); reason != "" {
+		p.skip(shown, info, reason, detail)
+		return nil
+	}
+	// The same file reached through several links is copied once
+	if first, ok := p.duplicateOf(shown, real, info, link); ok {
+		p.skip(shown, info, SkipDuplicate, first)
 		return nil
 	}
+	return p.copyEntry(shown, path, real, info, FileSpec{Path: shown})
+}
 
-	// Segunda passagem: processa os arquivos
-	if p.config.FollowSymlinks {
-		err := filepath.Walk(baseDir, func(path string, info os.FileInfo, err error) error {
-			// Implementação personalizada para seguir links simbólicos
-			if err != nil {
-				return err
-			}
+// copyEntry copies a selected file, or the lines of it named by spec, or
+// measures it in list mode, and adds it to the statistics
+func (p *Processor) copyEntry(shown, path, real string, info os.FileInfo, spec FileSpec) error {
+	lines := spec.Lines
+	ext := strings.ToLower(filepath.Ext(shown))
 
-			// Se for um link simbólico
-			if info.Mode()&os.ModeSymlink != 0 {
-				// Resolve o link simbólico
-				realPath, err := os.Readlink(path)
-				if err != nil {
-					return nil // Ignora erro ao ler o link
-				}
+	// Headers show the path in the tree unless the target path is asked for
+	name := shown
+	if p.config.SymlinkPath == SymlinkPathTarget {
+		name = p.displayPath(real)
+	}
+	if !lines.IsZero() {
+		name = FileSpec{Path: name, Lines: lines, Symbol: spec.Symbol}.String()
+	}
 
-				// Se for um caminho relativo, torna-o absoluto
-				if !filepath.IsAbs(realPath) {
-					realPath = filepath.Join(filepath.Dir(path), realPath)
-				}
+	// In list mode the content is measured instead of written
+	var file FileStat
+	var err error
+	if p.config.ListOnly {
+		entry, err := p.measureFile(path, info, lines)
+		if err != nil {
+			return p.fileError(shown, err)
+		}
+		entry.Path = name
+		p.entries = append(p.entries, entry)
+		file = entry.stat
+	} else {
+		// Process file
+		file, err = p.processFile(path, name, lines)
+		if err != nil {
+			return p.fileError(shown, err)
+		}
+	}
 
-				// Obtém informações sobre o destino do link
-				destInfo, err := os.Stat(realPath)
-				if err != nil {
-					return nil // Ignora erro ao acessar o destino do link
-				}
+	// Update statistics
+	file.Path = name
+	file.Ext = ext
+	if lines.IsZero() {
+		file.Bytes = info.Size()
+	}
+	p.stats.Files = append(p.stats.Files, file)
+	p.stats.TotalFiles++
+	p.stats.FilesByExt[ext]++
+	p.stats.InputBytes += file.Bytes
+	p.stats.InputLines += file.InputLines
+	if !p.config.ListOnly {
+		p.stats.OutputBytes += file.OutputBytes
+		p.stats.OutputLines += file.Lines
+	}
+	p.stats.CommentsRemoved += file.commentsRemoved
 
-				// Se o destino for um diretório, processa-o recursivamente
-				if destInfo.IsDir() {
-					return filepath.Walk(realPath, processFunc)
-				}
+	if p.config.OnFile != nil {
+		return p.config.OnFile(file)
+	}
+	return nil
+}
 
-				// Se for um arquivo, processa-o normalmente usando o destino do link
-				return processFunc(realPath, destInfo, nil)
-			}
+// skip counts a file left out by a filter and lists it when asked to
+func (p *Processor) skip(path string, info os.FileInfo, reason SkipReason, detail string) {
+	p.stats.Skipped[reason]++
+	if reason == SkipExtension {
+		return
+	}
+	entry := Entry{Path: path, Size: info.Size(), Reason: reason, Detail: detail}
+	if p.config.ListRejected {
+		p.entries = append(p.entries, entry)
+	}
+	if p.config.OnSkip != nil {
+		p.config.OnSkip(entry)
+	}
+}
 
-			// Para arquivos e diretórios normais, usa a função de processamento padrão
-			return processFunc(path, info, err)
-		})
-		return err
-	} else {
-		return filepath.Walk(baseDir, processFunc)
+// fileError handles a failure to read path. Output failures and, in strict
+// mode, every failure stop the walk; otherwise the file is recorded in
+// Stats.Errors and skipped.
+func (p *Processor) fileError(path string, err error) error {
+	if p.output.err != nil {
+		return p.output.err
+	}
+	if ctxErr := p.ctx.Err(); ctxErr != nil {
+		return ctxErr
 	}
+	fileErr := FileError{Path: path, Err: err}
+	if p.config.Strict {
+		return fileErr
+	}
+	p.stats.Errors = append(p.stats.Errors, fileErr)
+	return nil
 }
 
 // GetStats returns the processing statistics
@@ -272,18 +546,16 @@ func (p *Processor) GetStats() Stats {
 	return p.stats
 }
 
-// GetOutput returns the output stored in memory
-func (p *Processor) GetOutput() string {
-	return p.output.String()
+// GetEntries returns the files listed in list mode, in walk order
+func (p *Processor) GetEntries() []Entry {
+	return p.entries
 }
 
-func (p *Processor) shouldExclude(path string) bool {
-	for _, pattern := range p.config.ExcludePatterns {
-		if pattern != "" && strings.Contains(path, pattern) {
-			return true
-		}
-	}
-	return false
+// samePath reports whether a and b refer to the same location
+func samePath(a, b string) bool {
+	absA, errA := filepath.Abs(a)
+	absB, errB := filepath.Abs(b)
+	return errA == nil && errB == nil && absA == absB
 }
 
 func (p *Processor) hasValidExtension(ext string) bool {
@@ -304,60 +576,232 @@ func (p *Processor) hasValidExtension(ext string) bool {
 	return false
 }
 
-func (p *Processor) processFile(path string, isLastFile bool) error {
-	file, err := os.Open(path)
+// measureFile builds the list entry of a selected file, reading its content
+// through the same transforms as processFile when details are requested
+func (p *Processor) measureFile(path string, info os.FileInfo, lines LineRange) (Entry, error) {
+	entry := Entry{Path: path, Size: info.Size(), Selected: true}
+	if !p.config.ListDetails && lines.IsZero() {
+		return entry, nil
+	}
+
+	file, err := p.open(path)
 	if err != nil {
-		return err
+		return entry, err
+	}
+	defer file.Close()
+
+	content, _, err := decodeReader(file, p.config.FallbackEncoding)
+	if err != nil {
+		return entry, err
+	}
+	section := newLineRangeReader(content, lines)
+	if !lines.IsZero() {
+		content = section
+	}
+	content, inputLines, outlined, err := p.outline(path, content, lines)
+	if err != nil {
+		return entry, err
+	}
+
+	counter := &countingWriter{w: io.Discard}
+	res, err := copyContent(counter, content, p.config.StripComments, p.config.EOL)
+	if err != nil {
+		return entry, err
+	}
+	entry.stat = contentStat(path, res, counter.n)
+	if outlined {
+		entry.stat.InputLines = inputLines
+	}
+	if !lines.IsZero() {
+		entry.Size = section.n
+		entry.stat.Bytes = section.n
+	}
+	entry.Lines = entry.stat.Lines
+	entry.Tokens = entry.stat.Tokens
+	return entry, nil
+}
+
+// open opens the file name of the tree being processed
+func (p *Processor) open(name string) (io.ReadCloser, error) {
+	file, err := p.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{&contextReader{ctx: p.ctx, r: file}, file}, nil
+}
+
+// countingWriter counts the bytes written to w
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(b []byte) (int, error) {
+	n, err := c.w.Write(b)
+	c.n += int64(n)
+	return n, err
+}
+
+// processFile writes the header, naming the file name, and the content of the
+// file at path, or of its range lines, and returns the lines and tokens of the
+// content written
+func (p *Processor) processFile(path, name string, lines LineRange) (FileStat, error) {
+	stat := FileStat{Path: name}
+	file, err := p.open(path)
+	if err != nil {
+		return stat, err
 	}
 	defer file.Close()
 
-	// Format header
-	header := fmt.Sprintf(p.config.HeaderFormat+"\n", path)
+	// Decode the content to UTF-8 before any transform sees it. Sniffing reads
+	// the start of the file, so read errors show up before anything is written.
+	decoded, encoding, err := decodeReader(file, p.config.FallbackEncoding)
+	if err != nil {
+		return stat, err
+	}
+	content := decoded
+	section := newLineRangeReader(content, lines)
+	if !lines.IsZero() {
+		content = section
+	}
+	content, inputLines, outlined, err := p.outline(path, content, lines)
+	if err != nil {
+		return stat, err
+	}
+
+	out := p.output
+	nl := newline(p.config.EOL)
 
-	// Count the header line
-	p.stats.TotalLines++
+	// Add blank line between files, terminating a last line that has no
+	// newline so the header starts on its own line
+	if p.filesWritten > 0 {
+		separator := nl
+		if !p.lastEndsNewline {
+			separator = nl + nl
+		}
+		if _, err := io.WriteString(out, separator); err != nil {
+			return stat, err
+		}
+		p.addOverhead(separator)
+	}
 
 	// Write header
-	if p.config.OutputToMemory {
-		p.output.WriteString(header)
-	} else {
-		fmt.Print(header)
+	header := fmt.Sprintf(p.config.HeaderFormat, p.config.HeaderPrefix+name) + nl
+	if _, err := io.WriteString(out, header); err != nil {
+		return stat, err
 	}
+	p.filesWritten++
+	p.lastEndsNewline = true
+	p.addOverhead(header)
 
-	// Process content line by line to reduce memory usage
-	scanner := bufio.NewScanner(file)
-	for scanner.Scan() {
-		line := scanner.Text()
+	if outlined {
+		p.stats.FilesOutlined++
+	}
 
-		// If strip comments is enabled, skip lines that are comments
-		if p.config.StripComments && IsLineComment(line) {
-			// Count removed comment lines
-			p.stats.CommentsRemoved++
-			continue
-		}
+	// Stream the content, so no single line can exhaust a fixed-size buffer
+	counter := &countingWriter{w: out}
+	res, err := copyContent(counter, content, p.config.StripComments, p.config.EOL)
+	if decodedEncoding(decoded, encoding) != EncodingUTF8 {
+		p.stats.FilesTranscoded++
+	}
+	stat = contentStat(name, res, counter.n)
+	stat.Bytes = section.n
+	if outlined {
+		stat.InputLines = inputLines
+	}
+	if !res.Empty {
+		p.lastEndsNewline = res.EndsWithNewline
+	}
+	return stat, err
+}
 
-		// Write the line to output
-		if p.config.OutputToMemory {
-			p.output.WriteString(line + "\n")
-		} else {
-			fmt.Println(line)
-		}
-		p.stats.TotalLines++
+// outline replaces content with its outline in outline mode. Ranges of lines
+// were asked for explicitly, so they are copied as they are.
+func (p *Processor) outline(path string, content io.Reader, lines LineRange) (io.Reader, int, bool, error) {
+	if !p.config.Outline || !lines.IsZero() {
+		return content, 0, false, nil
 	}
+	return outlineContent(path, content, p.config.Outliners)
+}
 
-	if err := scanner.Err(); err != nil {
-		return err
+// contentStat describes the content of a file copied by copyContent
+func contentStat(path string, res copyResult, written int64) FileStat {
+	return FileStat{
+		Path:        path,
+		InputLines:  res.Lines + res.CommentsRemoved,
+		Lines:       res.Lines,
+		OutputBytes: written,
+		Tokens:      EstimateTokens(written),
+
+		commentsRemoved: res.CommentsRemoved,
 	}
+}
 
-	// Add blank line between files, but not after the last file
-	if !isLastFile {
-		if p.config.OutputToMemory {
-			p.output.WriteString("\n")
-		} else {
-			fmt.Println()
-		}
-		p.stats.TotalLines++
+// addOverhead counts a header or separator written between file contents.
+// A separator is a single line: when it has two newlines, the first one
+// terminates the last line of the previous file.
+func (p *Processor) addOverhead(text string) {
+	p.stats.OverheadBytes += int64(len(text))
+	p.stats.OverheadLines++
+	p.stats.OutputBytes += int64(len(text))
+	p.stats.OutputLines++
+}
+
+// duplicateOf returns the path the file behind path was already selected
+// under, and records path otherwise. Only a path through a link is a
+// duplicate: files reached under their own path are always copied, hard
+// links included, and a link to a file the walk selects under its own path
+// gives way to it, whether the link comes first or not.
+func (p *Processor) duplicateOf(path, real string, info os.FileInfo, link bool) (string, bool) {
+	if p.root == "" {
+		// Files of an fs.FS have no identity besides their path
+		return "", false
+	}
+	id, ok := fileIdentity(real, info)
+	if !ok {
+		// Unresolvable paths fail when they are read
+		return "", false
 	}
+	if !link {
+		p.seen[id] = path
+		return "", false
+	}
+	if first, ok := p.seen[id]; ok {
+		return first, true
+	}
+	if own, ok := p.ownPath(real, info); ok {
+		p.seen[id] = own
+		return own, true
+	}
+	p.seen[id] = path
+	return "", false
+}
 
-	return nil
+// ownPath returns the path the walk selects the file at the real path real
+// under, when it is inside the base directory and no filter rejects it
+func (p *Processor) ownPath(real string, info os.FileInfo) (string, bool) {
+	if !p.inRoot(real) {
+		return "", false
+	}
+	path := p.displayPath(real)
+	if p.inSkippedDir(path) {
+		return "", false
+	}
+	if reason, _ := p.selectFile(path, info); reason != "" {
+		return "", false
+	}
+	return path, true
+}
+
+// inSkippedDir reports whether a directory the walk skips contains path
+func (p *Processor) inSkippedDir(path string) bool {
+	for dir := filepath.Dir(path); dir != p.root && dir != "." && dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if p.skipDir(dir) {
+			return true
+		}
+	}
+	return false
 }
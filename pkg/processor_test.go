@@ -0,0 +1,225 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestProcessFS(t *testing.T) {
+	tests := []struct {
+		name    string
+		files   map[string]string
+		config  Config
+		want    string
+		skipped map[SkipReason]int
+	}{
+		{
+			name: "selection by extension",
+			files: map[string]string{
+				"main.go":       "package main\n",
+				"web/app.js":    "run()\n",
+				"notes.txt":     "not selected\n",
+				"Makefile":      "all:\n",
+				"lib/util.GO":   "package lib\n",
+				"docs/guide.md": "# Guide\n",
+			},
+			config:  Config{Extensions: []string{"go", ".js"}},
+			want:    "// file: lib/util.GO\npackage lib\n\n// file: main.go\npackage main\n\n// file: web/app.js\nrun()\n",
+			skipped: map[SkipReason]int{SkipExtension: 3},
+		},
+		{
+			name: "dot files",
+			files: map[string]string{
+				"a.go":          "package a\n",
+				".hidden.go":    "package hidden\n",
+				".git/hooks.go": "package hooks\n",
+			},
+			want:    "// file: a.go\npackage a\n",
+			skipped: map[SkipReason]int{SkipDotFile: 1},
+		},
+		{
+			name: "dot files included",
+			files: map[string]string{
+				"a.go":       "package a\n",
+				".hidden.go": "package hidden\n",
+			},
+			config:  Config{IncludeDotFiles: true},
+			want:    "// file: .hidden.go\npackage hidden\n\n// file: a.go\npackage a\n",
+			skipped: map[SkipReason]int{},
+		},
+		{
+			name: "exclusion",
+			files: map[string]string{
+				"a.go":              "package a\n",
+				"vendor/dep/dep.go": "package dep\n",
+				"gen_test.go":       "package a\n",
+			},
+			config:  Config{ExcludePatterns: []string{"vendor", "_test"}},
+			want:    "// file: a.go\npackage a\n",
+			skipped: map[SkipReason]int{SkipExcluded: 2},
+		},
+		{
+			name: "gitignore",
+			files: map[string]string{
+				".gitignore":   "# build output\nbuild/\n*_gen.go\n",
+				"a.go":         "package a\n",
+				"a_gen.go":     "package a\n",
+				"build/out.go": "package build\n",
+			},
+			want:    "// file: a.go\npackage a\n",
+			skipped: map[SkipReason]int{SkipGitIgnore: 2},
+		},
+		{
+			name: "max size",
+			files: map[string]string{
+				"small.go": "package a\n",
+				"big.go":   "package a\n\nvar data = []byte{}\n",
+			},
+			config:  Config{MaxSize: 10},
+			want:    "// file: small.go\npackage a\n",
+			skipped: map[SkipReason]int{SkipMaxSize: 1},
+		},
+		{
+			name: "outline",
+			files: map[string]string{
+				"a.go":     "package a\n\n// Add adds two numbers\nfunc Add(x, y int) int {\n\treturn x + y\n}\n",
+				"data.txt": "copied as is\n",
+			},
+			config:  Config{Extensions: []string{"go", "txt"}, Outline: true},
+			want:    "// file: a.go\npackage a\n\n// Add adds two numbers\nfunc Add(x, y int) int\n\n// file: data.txt\ncopied as is\n",
+			skipped: map[SkipReason]int{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fsys := fstest.MapFS{}
+			for name, content := range tt.files {
+				fsys[name] = &fstest.MapFile{Data: []byte(content)}
+			}
+
+			var out bytes.Buffer
+			config := tt.config
+			config.HeaderFormat = "// file: %s"
+			if config.Extensions == nil {
+				config.Extensions = []string{"go"}
+			}
+			config.Output = &out
+			p := NewProcessor(config)
+			if err := p.ProcessFS(context.Background(), fsys); err != nil {
+				t.Fatalf("ProcessFS: %v", err)
+			}
+
+			if out.String() != tt.want {
+				t.Errorf("output:\n%s\nwant:\n%s", out.String(), tt.want)
+			}
+			stats := p.GetStats()
+			for reason, want := range tt.skipped {
+				if stats.Skipped[reason] != want {
+					t.Errorf("Skipped[%s] = %d, want %d", reason, stats.Skipped[reason], want)
+				}
+			}
+		})
+	}
+}
+
+func TestDuplicates(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		links  map[string]string
+		hard   map[string]string // Hard links to files
+		config Config
+		want   []string
+	}{
+		{
+			// The file is kept under its own path whether its link comes
+			// before it in the walk or after it
+			name:  "link before the file",
+			files: map[string]string{"b.go": "package b\n"},
+			links: map[string]string{"alias.go": "b.go"},
+			want:  []string{"alias.go duplicate of b.go", "b.go"},
+		},
+		{
+			name:  "link after the file",
+			files: map[string]string{"b.go": "package b\n"},
+			links: map[string]string{"z.go": "b.go"},
+			want:  []string{"b.go", "z.go duplicate of b.go"},
+		},
+		{
+			name:  "hard links",
+			files: map[string]string{"a.go": "package a\n"},
+			hard:  map[string]string{"b.go": "a.go"},
+			want:  []string{"a.go", "b.go"},
+		},
+		{
+			// A link to a file left out is copied in its place
+			name:   "link to an excluded file",
+			files:  map[string]string{"vendor/v.go": "package v\n"},
+			links:  map[string]string{"v.go": "vendor/v.go"},
+			config: Config{ExcludePatterns: []string{"vendor"}},
+			want:   []string{"v.go", "vendor/v.go exclude of vendor"},
+		},
+		{
+			name:   "directory link before the directory",
+			files:  map[string]string{"lib/x.go": "package lib\n"},
+			links:  map[string]string{"a-lib": "lib", "lib/y.go": "x.go"},
+			config: Config{FollowSymlinks: true},
+			want:   []string{"a-lib duplicate of lib", "lib/x.go", "lib/y.go duplicate of lib/x.go"},
+		},
+		{
+			// Links out of the tree are told apart by the file they lead to
+			name:   "links out of the tree",
+			files:  map[string]string{"../shared/s.go": "package s\n", "a.go": "package a\n"},
+			links:  map[string]string{"s1.go": "../shared/s.go", "s2.go": "../shared/s.go"},
+			config: Config{FollowSymlinks: true},
+			want:   []string{"a.go", "s1.go", "s2.go duplicate of s1.go"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "root")
+			writeTree(t, dir, tt.files, tt.links)
+			for name, target := range tt.hard {
+				if err := os.Link(filepath.Join(dir, target), filepath.Join(dir, name)); err != nil {
+					t.Skipf("hard links not supported: %v", err)
+				}
+			}
+			wd, err := os.Getwd()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chdir(dir); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Chdir(wd)
+
+			config := tt.config
+			config.Extensions = []string{"go"}
+			config.ListOnly = true
+			config.ListRejected = true
+			p := NewProcessor(config)
+			if err := p.ProcessContext(context.Background(), "."); err != nil {
+				t.Fatalf("ProcessContext: %v", err)
+			}
+
+			var got []string
+			for _, entry := range p.GetEntries() {
+				line := filepath.ToSlash(entry.Path)
+				if entry.Reason != "" {
+					line += " " + string(entry.Reason) + " of " + filepath.ToSlash(entry.Detail)
+				}
+				got = append(got, line)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,124 @@
+package pkg
+
+import (
+	"context"
+	"io"
+	"time"
+)
+
+// ProgressReporter is told about the progress of a run after each file. It is
+// called from the goroutine running the processor, so it should return quickly.
+type ProgressReporter interface {
+	Progress(Progress)
+}
+
+// ProgressFunc adapts a function to ProgressReporter
+type ProgressFunc func(Progress)
+
+func (f ProgressFunc) Progress(p Progress) {
+	f(p)
+}
+
+// Progress describes how far a run is
+type Progress struct {
+	Path     string // The last file seen
+	Scanned  int    // Files seen, selected or not
+	Selected int    // Files copied
+	Bytes    int64  // Size of the files copied
+
+	// What the run will copy, estimated by a scan made before it, so the
+	// files are selected but not read; 0 when not known
+	TotalFiles int
+	TotalBytes int64
+
+	// Estimating is set while that scan runs: only Path and Scanned, the
+	// files it has seen so far, are known
+	Estimating bool
+
+	Elapsed time.Duration
+	Done    bool // Set on the last report, once the run is over
+}
+
+// ETA estimates the time left from the rate so far, or returns 0 when it
+// can't be estimated
+func (p Progress) ETA() time.Duration {
+	switch {
+	case p.Done:
+		return 0
+	case p.TotalBytes > 0 && p.Bytes > 0:
+		return time.Duration(float64(p.Elapsed) * float64(p.TotalBytes-p.Bytes) / float64(p.Bytes))
+	case p.TotalFiles > 0 && p.Selected > 0:
+		return time.Duration(float64(p.Elapsed) * float64(p.TotalFiles-p.Selected) / float64(p.Selected))
+	}
+	return 0
+}
+
+// Fraction returns the part of the run done, from 0 to 1, or -1 when the
+// total is not known
+func (p Progress) Fraction() float64 {
+	switch {
+	case p.Done:
+		return 1
+	case p.TotalBytes > 0:
+		return float64(p.Bytes) / float64(p.TotalBytes)
+	case p.TotalFiles > 0:
+		return float64(p.Selected) / float64(p.TotalFiles)
+	}
+	return -1
+}
+
+// estimate runs walk on a processor that only lists the selection, to learn
+// how many files and bytes the run will copy, reporting the files it sees
+func (p *Processor) estimate(ctx context.Context, walk func(*Processor) error) error {
+	config := p.config
+	config.Output = io.Discard
+	config.ListOnly = true
+	config.ListDetails = false
+	config.ListRejected = false
+	config.Strict = false
+	config.OnFile = nil
+	config.OnSkip = nil
+	config.Progress = ProgressFunc(func(scanned Progress) {
+		p.config.Progress.Progress(Progress{
+			Path:       scanned.Path,
+			Scanned:    scanned.Scanned,
+			Estimating: true,
+			Elapsed:    time.Since(p.start),
+		})
+	})
+
+	scan := NewProcessor(config)
+	scan.ctx = ctx
+	if err := walk(scan); err != nil {
+		return err
+	}
+	p.progress.TotalFiles = scan.stats.TotalFiles
+	p.progress.TotalBytes = scan.stats.InputBytes
+	return nil
+}
+
+// reportProgress tells the progress reporter about the file at path
+func (p *Processor) reportProgress(path string) {
+	if p.config.Progress == nil {
+		return
+	}
+	p.progress.Path = path
+	p.progress.Selected = p.stats.TotalFiles
+	p.progress.Bytes = p.stats.InputBytes
+	p.progress.Elapsed = time.Since(p.start)
+	p.config.Progress.Progress(p.progress)
+}
+
+// contextReader fails reads once ctx is done, so a large file doesn't delay
+// cancellation
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (c *contextReader) Read(b []byte) (int, error) {
+	if err := c.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return c.r.Read(b)
+}
@@ -0,0 +1,48 @@
+package pkg
+
+import (
+	"context"
+	"io"
+	"testing"
+	"testing/fstest"
+)
+
+func TestProgressEstimate(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.go":     {Data: []byte("package a\n")},
+		"b.go":     {Data: []byte("package b\n")},
+		"note.txt": {Data: []byte("not selected\n")},
+	}
+
+	var reports []Progress
+	p := NewProcessor(Config{
+		HeaderFormat: "// file: %s",
+		Extensions:   []string{"go"},
+		Output:       io.Discard,
+		Progress:     ProgressFunc(func(pr Progress) { reports = append(reports, pr) }),
+	})
+	if err := p.ProcessFS(context.Background(), fsys); err != nil {
+		t.Fatalf("ProcessFS: %v", err)
+	}
+
+	// The scan reports each file it sees, then the run each file it copies
+	var scanned []int
+	for _, pr := range reports {
+		if pr.Estimating {
+			scanned = append(scanned, pr.Scanned)
+			if pr.Selected != 0 || pr.TotalFiles != 0 {
+				t.Errorf("estimating report %+v has run fields set", pr)
+			}
+			continue
+		}
+		if pr.TotalFiles != 2 || pr.TotalBytes != 20 {
+			t.Errorf("run report totals = %d files, %d bytes, want 2 files, 20 bytes", pr.TotalFiles, pr.TotalBytes)
+		}
+	}
+	if len(scanned) != 3 || scanned[0] != 1 || scanned[2] != 3 {
+		t.Errorf("estimating reports scanned %v, want [1 2 3]", scanned)
+	}
+	if last := reports[len(reports)-1]; !last.Done || last.Estimating {
+		t.Errorf("last report = %+v, want Done", last)
+	}
+}
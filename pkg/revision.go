@@ -0,0 +1,86 @@
+package pkg
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os/exec"
+	"strconv"
+	"strings"
+)
+
+// OpenRevision opens the current directory as it is at revision rev (a
+// commit, tag or branch) of the git repository containing it, without
+// checking it out. Only regular files are included; their content is read
+// from the repository when they are opened. A revision that doesn't name a
+// commit is an error of kind KindUsage.
+func OpenRevision(rev string) (fs.FS, error) {
+	if strings.HasPrefix(rev, "-") {
+		return nil, NewError(KindUsage, fmt.Errorf("invalid revision %q", rev))
+	}
+	commit, err := git("rev-parse", "--verify", "--quiet", rev+"^{commit}")
+	if err != nil {
+		// With --quiet, git only explains failures other than a bad revision
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return nil, NewError(KindUsage, fmt.Errorf("unknown revision %q", rev))
+		}
+		return nil, err
+	}
+	commit = bytes.TrimSpace(commit)
+
+	// Without --full-tree the listing is limited to the current directory,
+	// with paths relative to it, like a walk of "."
+	listing, err := git("ls-tree", "-r", "-l", "-z", string(commit))
+	if err != nil {
+		return nil, err
+	}
+
+	fsys := make(memFS)
+	for _, record := range bytes.Split(listing, []byte{0}) {
+		// <mode> SP <type> SP <object> SP+ <size> TAB <path>
+		meta, name, ok := strings.Cut(string(record), "\t")
+		if !ok {
+			continue
+		}
+		fields := strings.Fields(meta)
+		if len(fields) != 4 || fields[1] != "blob" || fields[0] == "120000" {
+			// Submodules and symbolic links have no content to copy
+			continue
+		}
+		size, err := strconv.ParseInt(fields[3], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("unexpected git ls-tree output %q", record)
+		}
+		object := fields[2]
+		mode := fs.FileMode(0644)
+		if fields[0] == "100755" {
+			mode = 0755
+		}
+		fsys[name] = &memFile{
+			size: size,
+			mode: mode,
+			load: func() ([]byte, error) {
+				return git("cat-file", "blob", object)
+			},
+		}
+	}
+	return fsys, nil
+}
+
+// git runs a git command in the current directory and returns its output
+func git(args ...string) ([]byte, error) {
+	var stderr bytes.Buffer
+	cmd := exec.Command("git", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) && stderr.Len() > 0 {
+			return nil, fmt.Errorf("git %s: %s", args[0], strings.TrimSpace(stderr.String()))
+		}
+		return nil, fmt.Errorf("git %s: %w", args[0], err)
+	}
+	return out, nil
+}
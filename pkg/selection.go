@@ -0,0 +1,207 @@
+package pkg
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SkipReason tells which rule rejected a file
+type SkipReason string
+
+const (
+	SkipExtension   SkipReason = "extension"    // The extension is not one of the requested ones
+	SkipDotFile     SkipReason = "dot-file"     // The name starts with a dot and --all is not set
+	SkipGitIgnore   SkipReason = "gitignore"    // A .gitignore pattern matches the path
+	SkipExcluded    SkipReason = "exclude"      // An --exclude pattern matches the path
+	SkipOutputFile  SkipReason = "output-file"  // The file is the output file itself
+	SkipMaxSize     SkipReason = "max-size"     // The file is larger than --max-size
+	SkipDuplicate   SkipReason = "duplicate"    // The file or directory was already selected under another path
+	SkipCycle       SkipReason = "cycle"        // The link leads to a directory containing it
+	SkipOutsideRoot SkipReason = "outside-root" // The link leads outside the base directory
+)
+
+// Entry describes a file considered by the selection. Files whose extension
+// was not requested are not candidates and produce no entry.
+type Entry struct {
+	Path     string
+	Size     int64
+	Selected bool
+	Reason   SkipReason // Why the file was rejected, empty when selected
+	Detail   string     // The pattern or limit behind Reason
+	Lines    int        // Lines of content after transforms (list mode with details)
+	Tokens   int64      // Estimated tokens of content after transforms (list mode with details)
+
+	stat FileStat
+}
+
+// RuleCheck is the outcome of one filter on a file
+type RuleCheck struct {
+	Rule     SkipReason
+	Rejected bool
+	Detail   string // The pattern, limit or value the rule evaluated
+	Source   string // Where the rejecting pattern or limit comes from, e.g. ".gitignore:3"
+}
+
+// Explanation tells how the filter chain decides on a file
+type Explanation struct {
+	Path    string
+	Checks  []RuleCheck // Every rule, in the order they are applied
+	Verdict SkipReason  // The first rule rejecting the file, empty when selected
+}
+
+// fileRules is the filter chain, in order. The first rule rejecting a file
+// decides why it is skipped.
+var fileRules = []func(p *Processor, path string, info os.FileInfo) RuleCheck{
+	(*Processor).checkExtension,
+	(*Processor).checkDotFile,
+	(*Processor).checkGitIgnore,
+	(*Processor).checkOutputFile,
+	(*Processor).checkExclude,
+	(*Processor).checkMaxSize,
+}
+
+// selectFile runs the filter chain on a file and returns why it was rejected,
+// with the matching pattern or limit, or an empty reason when it is selected
+func (p *Processor) selectFile(path string, info os.FileInfo) (SkipReason, string) {
+	for _, rule := range fileRules {
+		if check := rule(p, path, info); check.Rejected {
+			return check.Rule, check.Detail
+		}
+	}
+	return "", ""
+}
+
+// Explain evaluates every rule of the filter chain on path, a file under
+// baseDir, without reading its content
+func (p *Processor) Explain(baseDir, path string) (Explanation, error) {
+	p.fsys = os.DirFS(baseDir)
+	p.root = baseDir
+	if err := p.loadGitIgnore(); err != nil {
+		return Explanation{}, NewError(KindIO, err)
+	}
+
+	// Links to files are read whether links are followed or not
+	info, err := os.Stat(path)
+	if err != nil {
+		return Explanation{}, NewError(KindIO, err)
+	}
+	if info.IsDir() {
+		return Explanation{}, NewError(KindUsage, fmt.Errorf("%s is a directory: explain a file inside it", path))
+	}
+
+	explanation := Explanation{Path: path}
+	for _, rule := range fileRules {
+		check := rule(p, path, info)
+		explanation.Checks = append(explanation.Checks, check)
+		if check.Rejected && explanation.Verdict == "" {
+			explanation.Verdict = check.Rule
+		}
+	}
+	return explanation, nil
+}
+
+func (p *Processor) checkExtension(path string, info os.FileInfo) RuleCheck {
+	ext := strings.ToLower(filepath.Ext(path))
+	check := RuleCheck{Rule: SkipExtension, Detail: ext}
+	if ext == "" {
+		check.Detail = "(none)"
+	}
+	check.Rejected = !p.hasValidExtension(ext)
+	return check
+}
+
+// checkDotFile rejects dot files and, since the walk never enters them,
+// files inside dot directories
+func (p *Processor) checkDotFile(path string, info os.FileInfo) RuleCheck {
+	check := RuleCheck{Rule: SkipDotFile}
+	if p.config.IncludeDotFiles {
+		check.Detail = "allowed by --all"
+		return check
+	}
+
+	// Ignora arquivos que começam com . a menos que includeDotFiles esteja ativado
+	for _, name := range strings.Split(filepath.ToSlash(path), "/") {
+		if strings.HasPrefix(name, ".") && name != "." && name != ".." {
+			check.Rejected = true
+			check.Detail = name
+			return check
+		}
+	}
+	return check
+}
+
+// checkGitIgnore rejects the files matching a .gitignore pattern
+func (p *Processor) checkGitIgnore(path string, info os.FileInfo) RuleCheck {
+	check := RuleCheck{Rule: SkipGitIgnore}
+	if pattern, ok := p.gitIgnore.Match(path); ok {
+		check.Rejected = true
+		check.Detail = pattern.Pattern
+		check.Source = fmt.Sprintf("%s:%d", pattern.Source, pattern.Line)
+	}
+	return check
+}
+
+// checkOutputFile never lets the output be copied into itself
+func (p *Processor) checkOutputFile(path string, info os.FileInfo) RuleCheck {
+	check := RuleCheck{Rule: SkipOutputFile}
+	if p.root != "" && p.config.OutputPath != "" && samePath(path, p.config.OutputPath) {
+		check.Rejected = true
+		check.Detail = p.config.OutputPath
+		check.Source = "--output"
+	}
+	return check
+}
+
+// checkExclude rejects the files matching an --exclude pattern
+func (p *Processor) checkExclude(path string, info os.FileInfo) RuleCheck {
+	check := RuleCheck{Rule: SkipExcluded}
+	if pattern, ok := p.excludedBy(path); ok {
+		check.Rejected = true
+		check.Detail = pattern
+		check.Source = p.config.ExcludeSource
+		if check.Source == "" {
+			check.Source = "--exclude"
+		}
+	}
+	return check
+}
+
+// checkMaxSize rejects the files larger than MaxSize
+func (p *Processor) checkMaxSize(path string, info os.FileInfo) RuleCheck {
+	check := RuleCheck{Rule: SkipMaxSize, Detail: FormatSize(info.Size()) + ", no limit"}
+	if p.config.MaxSize <= 0 {
+		return check
+	}
+	check.Detail = fmt.Sprintf("%s <= %s", FormatSize(info.Size()), FormatSize(p.config.MaxSize))
+	if info.Size() > p.config.MaxSize {
+		check.Rejected = true
+		check.Detail = fmt.Sprintf("%s > %s", FormatSize(info.Size()), FormatSize(p.config.MaxSize))
+		check.Source = "--max-size"
+	}
+	return check
+}
+
+// skipDir reports whether a directory is left out entirely
+func (p *Processor) skipDir(path string) bool {
+	// Ignora diretórios que começam com . a menos que includeDotFiles esteja ativado
+	baseName := filepath.Base(path)
+	return !p.config.IncludeDotFiles && strings.HasPrefix(baseName, ".") && path != "."
+}
+
+// excludedBy returns the --exclude pattern matching path
+func (p *Processor) excludedBy(path string) (string, bool) {
+	for _, pattern := range p.config.ExcludePatterns {
+		if pattern != "" && strings.Contains(path, pattern) {
+			return pattern, true
+		}
+	}
+	return "", false
+}
+
+// EstimateTokens approximates the number of tokens a language model needs for
+// size bytes of source code, using the common ratio of 4 bytes per token
+func EstimateTokens(size int64) int64 {
+	return (size + 3) / 4
+}
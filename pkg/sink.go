@@ -0,0 +1,107 @@
+package pkg
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+)
+
+// OutputLimitError is returned when content exceeds the capacity of a LimitedBuffer
+type OutputLimitError struct {
+	Limit int64
+}
+
+func (e *OutputLimitError) Error() string {
+	return fmt.Sprintf("output exceeds the limit of %s", FormatSize(e.Limit))
+}
+
+// LimitedBuffer is an in-memory sink that refuses to grow beyond a fixed size.
+// Writes that would exceed the limit fail with *OutputLimitError, which stops
+// processing early instead of exhausting memory.
+type LimitedBuffer struct {
+	buf   bytes.Buffer
+	limit int64
+}
+
+// NewLimitedBuffer creates a buffer holding at most limit bytes (0 means unlimited)
+func NewLimitedBuffer(limit int64) *LimitedBuffer {
+	return &LimitedBuffer{limit: limit}
+}
+
+// Write appends p to the buffer
+func (b *LimitedBuffer) Write(p []byte) (int, error) {
+	if b.limit > 0 && int64(b.buf.Len())+int64(len(p)) > b.limit {
+		return 0, &OutputLimitError{Limit: b.limit}
+	}
+	return b.buf.Write(p)
+}
+
+// Len returns the number of bytes held by the buffer
+func (b *LimitedBuffer) Len() int {
+	return b.buf.Len()
+}
+
+// String returns the buffered content
+func (b *LimitedBuffer) String() string {
+	return b.buf.String()
+}
+
+// CommandSink streams content to the standard input of a running command
+type CommandSink struct {
+	cmd   *exec.Cmd
+	stdin io.WriteCloser
+}
+
+// StartCommandSink runs command through the shell and returns a sink feeding
+// its standard input. The command's own output goes to stdout and stderr.
+func StartCommandSink(command string) (*CommandSink, error) {
+	cmd := exec.Command("sh", "-c", command)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("error starting %q: %v", command, err)
+	}
+	return &CommandSink{cmd: cmd, stdin: stdin}, nil
+}
+
+// Write sends p to the command
+func (s *CommandSink) Write(p []byte) (int, error) {
+	return s.stdin.Write(p)
+}
+
+// Close ends the command's input and waits for it to exit
+func (s *CommandSink) Close() error {
+	s.stdin.Close()
+	if err := s.cmd.Wait(); err != nil {
+		return fmt.Errorf("command %q failed: %v", s.cmd.Args[len(s.cmd.Args)-1], err)
+	}
+	return nil
+}
+
+// Kill stops the command before it sees the end of its input, so it doesn't
+// act on partial content, and waits for it to exit
+func (s *CommandSink) Kill() {
+	s.cmd.Process.Kill()
+	s.stdin.Close()
+	s.cmd.Wait()
+}
+
+// FormatSize renders a byte count using the same units accepted by --max-size
+func FormatSize(size int64) string {
+	switch {
+	case size >= 1024*1024*1024 && size%(1024*1024*1024) == 0:
+		return fmt.Sprintf("%dGB", size/(1024*1024*1024))
+	case size >= 1024*1024 && size%(1024*1024) == 0:
+		return fmt.Sprintf("%dMB", size/(1024*1024))
+	case size >= 1024 && size%1024 == 0:
+		return fmt.Sprintf("%dKB", size/1024)
+	}
+	return fmt.Sprintf("%d bytes", size)
+}
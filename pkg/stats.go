@@ -0,0 +1,271 @@
+package pkg
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Stats contains the processing statistics
+type Stats struct {
+	TotalFiles int
+	FilesByExt map[string]int
+
+	// Content read from the selected files and written to the output. The
+	// output includes the headers and separators, also counted as overhead.
+	// In list mode nothing is written: ListOnly is set and the output and
+	// overhead are 0.
+	ListOnly      bool
+	InputBytes    int64
+	InputLines    int
+	OutputBytes   int64
+	OutputLines   int
+	OverheadBytes int64
+	OverheadLines int
+
+	CommentsRemoved int
+	FilesTranscoded int                // Files converted to UTF-8 from another encoding
+	FilesOutlined   int                // Files replaced by their outline
+	Errors          []FileError        // Files skipped because they could not be read
+	Files           []FileStat         // Every file selected, in walk order
+	Skipped         map[SkipReason]int // Files left out by each filter
+	Elapsed         time.Duration
+}
+
+// FileStat describes a selected file. Lines, OutputBytes and Tokens count
+// the content after transforms, without header; in list mode they are only
+// known with ListDetails.
+type FileStat struct {
+	Path        string `json:"path"`
+	Ext         string `json:"ext"`
+	Bytes       int64  `json:"bytes"` // Size of the file on disk
+	InputLines  int    `json:"input_lines"`
+	Lines       int    `json:"lines"`
+	OutputBytes int64  `json:"output_bytes"`
+	Tokens      int64  `json:"tokens"`
+
+	commentsRemoved int
+}
+
+// Stats formats accepted by WriteStats
+const (
+	StatsFormatTable = "table"
+	StatsFormatJSON  = "json"
+)
+
+// DefaultStatsTop is the number of largest files reported by default
+const DefaultStatsTop = 5
+
+// ValidateStatsFormat checks a --stats-format value
+func ValidateStatsFormat(format string) error {
+	switch format {
+	case StatsFormatTable, StatsFormatJSON:
+		return nil
+	}
+	return fmt.Errorf("invalid stats-format %q: expected %s or %s", format, StatsFormatTable, StatsFormatJSON)
+}
+
+// StatsReport is the summary of a run, as written by WriteStats. In list
+// mode ListOnly is set, and the output and overhead fields are 0 since
+// nothing is written.
+type StatsReport struct {
+	Files           int                `json:"files"`
+	ListOnly        bool               `json:"list_only"`
+	InputBytes      int64              `json:"input_bytes"`
+	InputLines      int                `json:"input_lines"`
+	OutputBytes     int64              `json:"output_bytes"`
+	OutputLines     int                `json:"output_lines"`
+	OverheadBytes   int64              `json:"overhead_bytes"`
+	OverheadLines   int                `json:"overhead_lines"`
+	Tokens          int64              `json:"tokens"`
+	ElapsedMS       int64              `json:"elapsed_ms"`
+	Extensions      []ExtensionStats   `json:"extensions"`
+	Largest         []FileStat         `json:"largest"`
+	Skipped         map[SkipReason]int `json:"skipped"`
+	CommentsRemoved int                `json:"comments_removed"`
+	FilesTranscoded int                `json:"files_transcoded"`
+	FilesOutlined   int                `json:"files_outlined"`
+	Errors          []string           `json:"errors"`
+}
+
+// ExtensionStats totals the selected files of one extension
+type ExtensionStats struct {
+	Ext     string  `json:"ext"`
+	Files   int     `json:"files"`
+	Bytes   int64   `json:"bytes"` // Size of the files on disk
+	Lines   int     `json:"lines"` // Lines of content written
+	Tokens  int64   `json:"tokens"`
+	Percent float64 `json:"percent"` // Share of the input bytes
+}
+
+// Report summarizes the statistics, with extensions sorted by size and the
+// top largest files
+func (s Stats) Report(top int) StatsReport {
+	report := StatsReport{
+		Files:           s.TotalFiles,
+		ListOnly:        s.ListOnly,
+		InputBytes:      s.InputBytes,
+		InputLines:      s.InputLines,
+		OutputBytes:     s.OutputBytes,
+		OutputLines:     s.OutputLines,
+		OverheadBytes:   s.OverheadBytes,
+		OverheadLines:   s.OverheadLines,
+		ElapsedMS:       s.Elapsed.Milliseconds(),
+		Extensions:      []ExtensionStats{},
+		Largest:         []FileStat{},
+		Skipped:         s.Skipped,
+		CommentsRemoved: s.CommentsRemoved,
+		FilesTranscoded: s.FilesTranscoded,
+		FilesOutlined:   s.FilesOutlined,
+		Errors:          []string{},
+	}
+	if report.Skipped == nil {
+		report.Skipped = map[SkipReason]int{}
+	}
+
+	byExt := make(map[string]*ExtensionStats)
+	for _, file := range s.Files {
+		report.Tokens += file.Tokens
+		ext, ok := byExt[file.Ext]
+		if !ok {
+			ext = &ExtensionStats{Ext: file.Ext}
+			byExt[file.Ext] = ext
+		}
+		ext.Files++
+		ext.Bytes += file.Bytes
+		ext.Lines += file.Lines
+		ext.Tokens += file.Tokens
+	}
+	for _, ext := range byExt {
+		ext.Percent = percent(ext.Bytes, s.InputBytes)
+		report.Extensions = append(report.Extensions, *ext)
+	}
+	sort.Slice(report.Extensions, func(i, j int) bool {
+		a, b := report.Extensions[i], report.Extensions[j]
+		if a.Bytes != b.Bytes {
+			return a.Bytes > b.Bytes
+		}
+		return a.Ext < b.Ext
+	})
+
+	largest := append([]FileStat(nil), s.Files...)
+	sort.SliceStable(largest, func(i, j int) bool {
+		return largest[i].Bytes > largest[j].Bytes
+	})
+	if len(largest) > top {
+		largest = largest[:top]
+	}
+	report.Largest = append(report.Largest, largest...)
+
+	for _, fileErr := range s.Errors {
+		report.Errors = append(report.Errors, fileErr.Error())
+	}
+	return report
+}
+
+// WriteStats writes the statistics in format, listing the top largest files
+func WriteStats(w io.Writer, stats Stats, format string, top int) error {
+	report := stats.Report(top)
+	if format == StatsFormatJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "Total files: %d (~%d tokens) in %s\n", report.Files, report.Tokens, stats.Elapsed.Round(time.Millisecond))
+	fmt.Fprintf(tw, "Input: %s, %d lines\n", HumanSize(report.InputBytes), report.InputLines)
+	// Nothing is written in list mode
+	if !report.ListOnly {
+		fmt.Fprintf(tw, "Output: %s, %d lines (headers and separators: %s, %d lines)\n",
+			HumanSize(report.OutputBytes), report.OutputLines, HumanSize(report.OverheadBytes), report.OverheadLines)
+	}
+
+	if len(report.Extensions) > 0 {
+		fmt.Fprintf(tw, "\nExtension\tFiles\tSize\tShare\tLines\tTokens\t\n")
+		for _, ext := range report.Extensions {
+			fmt.Fprintf(tw, "%s\t%d\t%s\t%.1f%%\t%d\t%d\t\n", ext.Ext, ext.Files, HumanSize(ext.Bytes), ext.Percent, ext.Lines, ext.Tokens)
+		}
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	if len(report.Largest) > 0 {
+		fmt.Fprintf(w, "\nLargest files:\n")
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+		for _, file := range report.Largest {
+			fmt.Fprintf(tw, "\t%s\t%.1f%%\t  %s\n", HumanSize(file.Bytes), percent(file.Bytes, report.InputBytes), file.Path)
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	if len(report.Skipped) > 0 {
+		reasons := make([]string, 0, len(report.Skipped))
+		for reason := range report.Skipped {
+			reasons = append(reasons, string(reason))
+		}
+		sort.Strings(reasons)
+		fmt.Fprintf(w, "\nSkipped files:\n")
+		tw = tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		for _, reason := range reasons {
+			fmt.Fprintf(tw, "  %s\t%d\n", reason, report.Skipped[SkipReason(reason)])
+		}
+		if err := tw.Flush(); err != nil {
+			return err
+		}
+	}
+
+	var notes []string
+	if report.CommentsRemoved > 0 {
+		notes = append(notes, fmt.Sprintf("Removed lines (comments): %d", report.CommentsRemoved))
+	}
+	if report.FilesTranscoded > 0 {
+		notes = append(notes, fmt.Sprintf("Files converted to UTF-8: %d", report.FilesTranscoded))
+	}
+	if report.FilesOutlined > 0 {
+		notes = append(notes, fmt.Sprintf("Files outlined: %d", report.FilesOutlined))
+	}
+	if len(notes) > 0 {
+		fmt.Fprintf(w, "\n%s\n", strings.Join(notes, "\n"))
+	}
+
+	// List the files skipped because they could not be read
+	if len(report.Errors) > 0 {
+		fmt.Fprintf(w, "\nSkipped files (errors): %d\n", len(report.Errors))
+		for _, fileErr := range report.Errors {
+			fmt.Fprintf(w, "  %s\n", fileErr)
+		}
+	}
+	return nil
+}
+
+// HumanSize formats a number of bytes with one decimal in the largest unit
+// that keeps it at least 1, e.g. "512 B", "1.5 KB" or "12.0 MB"
+func HumanSize(size int64) string {
+	const unit = 1024
+	if size < unit {
+		return fmt.Sprintf("%d B", size)
+	}
+	value := float64(size) / unit
+	for _, suffix := range []string{"KB", "MB", "GB"} {
+		if value < unit || suffix == "GB" {
+			return fmt.Sprintf("%.1f %s", value, suffix)
+		}
+		value /= unit
+	}
+	return ""
+}
+
+func percent(part, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return float64(part) * 100 / float64(total)
+}
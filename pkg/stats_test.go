@@ -0,0 +1,235 @@
+package pkg
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// writeTree creates files, with their content, and symbolic links, with
+// their targets, under dir
+func writeTree(t *testing.T, dir string, files, links map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, target := range links {
+		if err := os.Symlink(filepath.FromSlash(target), filepath.Join(dir, filepath.FromSlash(name))); err != nil {
+			t.Skipf("symbolic links not supported: %v", err)
+		}
+	}
+}
+
+func TestStats(t *testing.T) {
+	tests := []struct {
+		name   string
+		files  map[string]string
+		links  map[string]string
+		config Config
+
+		total         int
+		inputBytes    int64
+		inputLines    int
+		outputBytes   int64
+		outputLines   int
+		overheadBytes int64
+		overheadLines int
+		comments      int
+		skipped       map[SkipReason]int
+	}{
+		{
+			// Headers of 14 bytes and a one-byte separator between the files
+			name: "two files",
+			files: map[string]string{
+				"a.go":     "package a\n",
+				"b.go":     "package b\n\nfunc B() {}\n",
+				"note.txt": "not selected\n",
+			},
+			total: 2, inputBytes: 33, inputLines: 4,
+			outputBytes: 62, outputLines: 7, overheadBytes: 29, overheadLines: 3,
+			skipped: map[SkipReason]int{SkipExtension: 1},
+		},
+		{
+			// The separator also terminates a last line without newline
+			name: "missing final newline",
+			files: map[string]string{
+				"a.go": "package a",
+				"b.go": "package b\n",
+			},
+			total: 2, inputBytes: 19, inputLines: 2,
+			outputBytes: 49, outputLines: 5, overheadBytes: 30, overheadLines: 3,
+			skipped: map[SkipReason]int{},
+		},
+		{
+			name:  "crlf preserved",
+			files: map[string]string{"a.go": "package a\r\nvar x = 1\r\n"},
+			total: 1, inputBytes: 22, inputLines: 2,
+			outputBytes: 36, outputLines: 3, overheadBytes: 14, overheadLines: 1,
+			skipped: map[SkipReason]int{},
+		},
+		{
+			name:   "crlf converted to lf",
+			files:  map[string]string{"a.go": "package a\r\nvar x = 1\r\n"},
+			config: Config{EOL: EOLLF},
+			total:  1, inputBytes: 22, inputLines: 2,
+			outputBytes: 34, outputLines: 3, overheadBytes: 14, overheadLines: 1,
+			skipped: map[SkipReason]int{},
+		},
+		{
+			// The headers follow the line endings asked for
+			name:   "lf converted to crlf",
+			files:  map[string]string{"a.go": "package a\nvar x = 1\n"},
+			config: Config{EOL: EOLCRLF},
+			total:  1, inputBytes: 20, inputLines: 2,
+			outputBytes: 37, outputLines: 3, overheadBytes: 15, overheadLines: 1,
+			skipped: map[SkipReason]int{},
+		},
+		{
+			// Comment lines count as input but are not written
+			name:   "strip comments",
+			files:  map[string]string{"a.go": "package a\n// comment\nvar x = 1 // trailing\n"},
+			config: Config{StripComments: true},
+			total:  1, inputBytes: 43, inputLines: 3,
+			outputBytes: 46, outputLines: 3, overheadBytes: 14, overheadLines: 1,
+			comments: 1,
+			skipped:  map[SkipReason]int{},
+		},
+		{
+			name: "filters",
+			files: map[string]string{
+				"a.go":        "package a\n",
+				".hidden.go":  "package hidden\n",
+				"vendor/v.go": "package v\n",
+				"big.go":      "package big\n\nvar data = 0\n",
+			},
+			config: Config{ExcludePatterns: []string{"vendor"}, MaxSize: 20},
+			total:  1, inputBytes: 10, inputLines: 1,
+			outputBytes: 24, outputLines: 2, overheadBytes: 14, overheadLines: 1,
+			skipped: map[SkipReason]int{SkipDotFile: 1, SkipExcluded: 1, SkipMaxSize: 1},
+		},
+		{
+			// A link to a selected file is copied once
+			name:  "duplicate link",
+			files: map[string]string{"a.go": "package a\n"},
+			links: map[string]string{"link.go": "a.go"},
+			total: 1, inputBytes: 10, inputLines: 1,
+			outputBytes: 24, outputLines: 2, overheadBytes: 14, overheadLines: 1,
+			skipped: map[SkipReason]int{SkipDuplicate: 1},
+		},
+		{
+			// A followed link to a directory already walked is skipped
+			name:   "duplicate directory",
+			files:  map[string]string{"lib/a.go": "package lib\n"},
+			links:  map[string]string{"z-alias": "lib"},
+			config: Config{FollowSymlinks: true},
+			total:  1, inputBytes: 12, inputLines: 1,
+			outputBytes: 30, outputLines: 2, overheadBytes: 18, overheadLines: 1,
+			skipped: map[SkipReason]int{SkipDuplicate: 1},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			writeTree(t, dir, tt.files, tt.links)
+			wd, err := os.Getwd()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := os.Chdir(dir); err != nil {
+				t.Fatal(err)
+			}
+			defer os.Chdir(wd)
+
+			var out bytes.Buffer
+			config := tt.config
+			config.HeaderFormat = "// file: %s"
+			config.Extensions = []string{"go"}
+			config.Output = &out
+			p := NewProcessor(config)
+			if err := p.ProcessContext(context.Background(), "."); err != nil {
+				t.Fatalf("ProcessContext: %v", err)
+			}
+
+			stats := p.GetStats()
+			if stats.TotalFiles != tt.total {
+				t.Errorf("TotalFiles = %d, want %d", stats.TotalFiles, tt.total)
+			}
+			if stats.InputBytes != tt.inputBytes || stats.InputLines != tt.inputLines {
+				t.Errorf("input = %d bytes, %d lines, want %d bytes, %d lines",
+					stats.InputBytes, stats.InputLines, tt.inputBytes, tt.inputLines)
+			}
+			if stats.OutputBytes != tt.outputBytes || stats.OutputLines != tt.outputLines {
+				t.Errorf("output = %d bytes, %d lines, want %d bytes, %d lines",
+					stats.OutputBytes, stats.OutputLines, tt.outputBytes, tt.outputLines)
+			}
+			if stats.OverheadBytes != tt.overheadBytes || stats.OverheadLines != tt.overheadLines {
+				t.Errorf("overhead = %d bytes, %d lines, want %d bytes, %d lines",
+					stats.OverheadBytes, stats.OverheadLines, tt.overheadBytes, tt.overheadLines)
+			}
+			if stats.CommentsRemoved != tt.comments {
+				t.Errorf("CommentsRemoved = %d, want %d", stats.CommentsRemoved, tt.comments)
+			}
+			for reason, want := range tt.skipped {
+				if stats.Skipped[reason] != want {
+					t.Errorf("Skipped[%s] = %d, want %d", reason, stats.Skipped[reason], want)
+				}
+			}
+
+			// The output counted is the output written
+			if int64(out.Len()) != stats.OutputBytes {
+				t.Errorf("%d bytes written, OutputBytes = %d", out.Len(), stats.OutputBytes)
+			}
+		})
+	}
+}
+
+func TestWriteStatsListOnly(t *testing.T) {
+	fsys := fstest.MapFS{
+		"a.go": {Data: []byte("package a\n")},
+		"b.go": {Data: []byte("package b\n\nvar x = 1\n")},
+	}
+	for _, listOnly := range []bool{false, true} {
+		p := NewProcessor(Config{Extensions: []string{"go"}, HeaderFormat: "// file: %s", Output: io.Discard, ListOnly: listOnly, ListDetails: true})
+		if err := p.ProcessFS(context.Background(), fsys); err != nil {
+			t.Fatal(err)
+		}
+
+		var table bytes.Buffer
+		if err := WriteStats(&table, p.GetStats(), StatsFormatTable, DefaultStatsTop); err != nil {
+			t.Fatal(err)
+		}
+		if hasOutput := strings.Contains(table.String(), "Output:"); hasOutput == listOnly {
+			t.Errorf("list only %v: table has the output row: %v\n%s", listOnly, hasOutput, table.String())
+		}
+
+		var out bytes.Buffer
+		if err := WriteStats(&out, p.GetStats(), StatsFormatJSON, DefaultStatsTop); err != nil {
+			t.Fatal(err)
+		}
+		var report StatsReport
+		if err := json.Unmarshal(out.Bytes(), &report); err != nil {
+			t.Fatal(err)
+		}
+		if report.ListOnly != listOnly || report.Files != 2 || report.InputBytes != 31 {
+			t.Errorf("list only %v: report = %+v", listOnly, report)
+		}
+		written := report.OutputBytes != 0 && report.OutputLines != 0 && report.OverheadBytes != 0 && report.OverheadLines != 0
+		if written == listOnly {
+			t.Errorf("list only %v: output %d bytes, %d lines, overhead %d bytes, %d lines",
+				listOnly, report.OutputBytes, report.OutputLines, report.OverheadBytes, report.OverheadLines)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package pkg
+
+import (
+	"fmt"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// FindSymbol returns the lines declaring symbol in the file name with content
+// src, with the doc comment above each declaration. Go files are parsed,
+// where symbol is a function, a type, a constant, a variable or a method
+// written as "Type.Method" or just "Method". Other languages are searched
+// with heuristics that know about braces and, for Python, indentation. A
+// name declared more than once, like methods of different types, gives a
+// range for each declaration. A symbol that isn't declared, or a Go file that
+// doesn't parse, is an error of kind KindUsage.
+func FindSymbol(name string, src []byte, symbol string) ([]LineRange, error) {
+	var ranges []LineRange
+	var err error
+	if strings.EqualFold(filepath.Ext(name), ".go") {
+		ranges, err = findGoSymbol(name, src, symbol)
+	} else {
+		ranges = findSymbolHeuristic(name, src, symbol)
+	}
+	if err != nil {
+		return nil, NewError(KindUsage, err)
+	}
+	if len(ranges) == 0 {
+		return nil, NewError(KindUsage, fmt.Errorf("symbol %q not found in %s", symbol, name))
+	}
+	sort.Slice(ranges, func(i, j int) bool { return ranges[i].Start < ranges[j].Start })
+	return ranges, nil
+}
+
+// findGoSymbol finds the declarations of symbol in a Go file
+func findGoSymbol(name string, src []byte, symbol string) ([]LineRange, error) {
+	fset := token.NewFileSet()
+	file, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+	if err != nil {
+		return nil, err
+	}
+
+	var ranges []LineRange
+	add := func(doc *ast.CommentGroup, from, to token.Pos) {
+		if doc != nil {
+			from = doc.Pos()
+		}
+		ranges = append(ranges, LineRange{Start: fset.Position(from).Line, End: fset.Position(to).Line})
+	}
+
+	for _, decl := range file.Decls {
+		switch decl := decl.(type) {
+		case *ast.FuncDecl:
+			if decl.Name.Name == symbol || receiverName(decl)+"."+decl.Name.Name == symbol {
+				add(decl.Doc, decl.Pos(), decl.End())
+			}
+		case *ast.GenDecl:
+			for _, spec := range decl.Specs {
+				var doc *ast.CommentGroup
+				found := false
+				switch spec := spec.(type) {
+				case *ast.TypeSpec:
+					doc, found = spec.Doc, spec.Name.Name == symbol
+				case *ast.ValueSpec:
+					doc = spec.Doc
+					for _, ident := range spec.Names {
+						found = found || ident.Name == symbol
+					}
+				}
+				if !found {
+					continue
+				}
+				// A declaration of a single name is taken whole, keyword included
+				if !decl.Lparen.IsValid() {
+					add(decl.Doc, decl.Pos(), decl.End())
+				} else {
+					add(doc, spec.Pos(), spec.End())
+				}
+			}
+		}
+	}
+	return ranges, nil
+}
+
+// receiverName returns the type name of the receiver of a method, without
+// pointer or type parameters, or "" for a function
+func receiverName(decl *ast.FuncDecl) string {
+	if decl.Recv == nil || len(decl.Recv.List) == 0 {
+		return ""
+	}
+	expr := decl.Recv.List[0].Type
+	for {
+		switch e := expr.(type) {
+		case *ast.StarExpr:
+			expr = e.X
+		case *ast.IndexExpr:
+			expr = e.X
+		case *ast.IndexListExpr:
+			expr = e.X
+		case *ast.Ident:
+			return e.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// declarationKeywords introduce a named declaration in the languages
+// searched by findSymbolHeuristic
+const declarationKeywords = `def|class|function|func|fn|struct|enum|union|interface|trait|impl|type|module|record|const|let|var|static`
+
+// findSymbolHeuristic finds declarations of symbol by their text: a
+// declaration keyword followed by the name, or a function definition like
+// "int name(...) {". The declaration ends where its braces balance or, in
+// Python, before the next line indented no deeper than it.
+func findSymbolHeuristic(name string, src []byte, symbol string) []LineRange {
+	quoted := regexp.QuoteMeta(symbol)
+	declaration := regexp.MustCompile(`(^|[^\w.])(` + declarationKeywords + `)\s+(\w+\s*::\s*)?` + quoted + `\b`)
+	definition := regexp.MustCompile(`^[\w\s\*&:<>,\[\]]*\b` + quoted + `\s*\(`)
+	python := strings.EqualFold(filepath.Ext(name), ".py")
+
+	lines := strings.Split(strings.ReplaceAll(string(src), "\r\n", "\n"), "\n")
+	var ranges []LineRange
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		trimmed := strings.TrimSpace(line)
+		if isCommentLine(trimmed) {
+			continue
+		}
+		// An indented line ending in ";" is a call rather than a prototype
+		call := strings.HasSuffix(trimmed, ";") && indentation(line) > 0
+		if !declaration.MatchString(line) && (python || call || !definition.MatchString(line)) {
+			continue
+		}
+
+		var end int
+		if python {
+			end = indentedBlockEnd(lines, i)
+		} else {
+			end = braceBlockEnd(lines, i)
+		}
+		ranges = append(ranges, LineRange{Start: docStart(lines, i) + 1, End: end + 1})
+		i = end
+	}
+	return ranges
+}
+
+// isCommentLine reports whether a trimmed line is a comment or part of one
+func isCommentLine(trimmed string) bool {
+	for _, prefix := range []string{"//", "#", "/*", "*", "--", `"""`, "'''"} {
+		if strings.HasPrefix(trimmed, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// docStart returns the first line of the comments, decorators and attributes
+// directly above the declaration at line i
+func docStart(lines []string, i int) int {
+	start := i
+	for start > 0 {
+		above := strings.TrimSpace(lines[start-1])
+		if above == "" || !(isCommentLine(above) || strings.HasPrefix(above, "@") || strings.HasPrefix(above, "#[")) {
+			break
+		}
+		start--
+	}
+	return start
+}
+
+// braceBlockEnd returns the line where the braces opened from line i are all
+// closed. A declaration ending in ";" before any brace is a single statement.
+func braceBlockEnd(lines []string, i int) int {
+	depth, opened := 0, false
+	for j := i; j < len(lines); j++ {
+		for _, r := range stripStrings(lines[j]) {
+			switch r {
+			case '{':
+				depth++
+				opened = true
+			case '}':
+				depth--
+			}
+		}
+		if opened && depth <= 0 {
+			return j
+		}
+		if !opened && strings.HasSuffix(strings.TrimSpace(lines[j]), ";") {
+			return j
+		}
+	}
+	return len(lines) - 1
+}
+
+// stringLiteral matches simple string and character literals, whose braces
+// don't count
+var stringLiteral = regexp.MustCompile(`"(\\.|[^"\\])*"|'(\\.|[^'\\])*'|` + "`[^`]*`")
+
+// stripStrings removes string literals and a trailing line comment from line
+func stripStrings(line string) string {
+	line = stringLiteral.ReplaceAllString(line, "")
+	if i := strings.Index(line, "//"); i >= 0 {
+		line = line[:i]
+	}
+	return line
+}
+
+// indentedBlockEnd returns the last line of the Python block starting at line
+// i: the lines after it are part of it while blank or indented deeper
+func indentedBlockEnd(lines []string, i int) int {
+	indent := indentation(lines[i])
+	end := i
+	for j := i + 1; j < len(lines); j++ {
+		if strings.TrimSpace(lines[j]) == "" {
+			continue
+		}
+		if indentation(lines[j]) <= indent {
+			break
+		}
+		end = j
+	}
+	return end
+}
+
+// indentation returns the width of the leading whitespace of line
+func indentation(line string) int {
+	return len(line) - len(strings.TrimLeft(line, " \t"))
+}
@@ -0,0 +1,257 @@
+package pkg
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const goSymbols = `package shapes
+
+import "fmt"
+
+// Shape is anything with an area
+type Shape interface {
+	Area() float64
+}
+
+type (
+	// Circle is a round shape
+	Circle struct{ R float64 }
+	Square struct{ Side float64 }
+)
+
+const (
+	Pi = 3.14159
+	// E is Euler's number
+	E = 2.71828
+)
+
+var Default = Circle{R: 1}
+
+// Area of the circle
+func (c Circle) Area() float64 {
+	return Pi * c.R * c.R
+}
+
+func (s *Square) Area() float64 {
+	return s.Side * s.Side
+}
+
+// Map applies f to the list
+func (l List[T]) Map(f func(T) T) {}
+
+// Describe prints a shape
+func Describe(s Shape) {
+	fmt.Println(s.Area())
+}
+`
+
+func TestFindGoSymbol(t *testing.T) {
+	tests := []struct {
+		symbol string
+		want   []LineRange
+	}{
+		{"Describe", []LineRange{{Start: 36, End: 39}}},
+		{"Shape", []LineRange{{Start: 5, End: 8}}},
+		// Specs of a group are taken alone, with their own doc comment
+		{"Circle", []LineRange{{Start: 11, End: 12}}},
+		{"Square", []LineRange{{Start: 13, End: 13}}},
+		{"Pi", []LineRange{{Start: 17, End: 17}}},
+		{"E", []LineRange{{Start: 18, End: 19}}},
+		{"Default", []LineRange{{Start: 22, End: 22}}},
+		// Methods by type, through pointers and type parameters, or by name alone
+		{"Circle.Area", []LineRange{{Start: 24, End: 27}}},
+		{"Square.Area", []LineRange{{Start: 29, End: 31}}},
+		{"Area", []LineRange{{Start: 24, End: 27}, {Start: 29, End: 31}}},
+		{"List.Map", []LineRange{{Start: 33, End: 34}}},
+		{"Missing", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.symbol, func(t *testing.T) {
+			got, err := findGoSymbol("shapes.go", []byte(goSymbols), tt.symbol)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findGoSymbol(%q) = %v, want %v", tt.symbol, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindSymbol(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		src    string
+		symbol string
+		want   []LineRange
+		kind   ErrorKind
+	}{
+		{
+			name: "go", file: "a.go", src: "package a\n\nfunc A() {}\n", symbol: "A",
+			want: []LineRange{{Start: 3, End: 3}},
+		},
+		{
+			name: "go not found", file: "a.go", src: "package a\n", symbol: "A",
+			kind: KindUsage,
+		},
+		{
+			name: "go that doesn't parse", file: "a.go", src: "package a\nfunc {", symbol: "A",
+			kind: KindUsage,
+		},
+		{
+			name: "heuristic not found", file: "a.js", src: "const a = 1;\n", symbol: "b",
+			kind: KindUsage,
+		},
+		{
+			// Ranges come in file order, whatever the order of the search
+			name: "python methods", file: "a.py", symbol: "run",
+			src:  "class A:\n    def run(self):\n        pass\n\nclass B:\n    def run(self):\n        pass\n",
+			want: []LineRange{{Start: 2, End: 3}, {Start: 6, End: 7}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := FindSymbol(tt.file, []byte(tt.src), tt.symbol)
+			if tt.kind != 0 {
+				if KindOf(err) != tt.kind {
+					t.Fatalf("FindSymbol error = %v (kind %v), want kind %v", err, KindOf(err), tt.kind)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("FindSymbol = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFindSymbolHeuristic(t *testing.T) {
+	tests := []struct {
+		name   string
+		file   string
+		src    string
+		symbol string
+		want   []LineRange
+	}{
+		{
+			name: "js function with doc comment", file: "a.js", symbol: "add",
+			src:  "/**\n * Adds\n */\nfunction add(a, b) {\n  return a + b;\n}\nmodule.exports = { add };\n",
+			want: []LineRange{{Start: 1, End: 6}},
+		},
+		{
+			// Braces in strings and after a line comment don't count
+			name: "braces in strings", file: "a.ts", symbol: "render",
+			src:  "function render() {\n  const open = \"{\";\n  const close = '}}';\n  // }\n  return `${open}`;\n}\nconst after = 1;\n",
+			want: []LineRange{{Start: 1, End: 6}},
+		},
+		{
+			name: "statement without braces", file: "a.ts", symbol: "limit",
+			src:  "export const limit = 10;\nconst other = 2;\n",
+			want: []LineRange{{Start: 1, End: 1}},
+		},
+		{
+			name: "c definition", file: "a.c", symbol: "main",
+			src:  "#include <stdio.h>\n\nint main(void)\n{\n    helper();\n    return 0;\n}\n",
+			want: []LineRange{{Start: 3, End: 7}},
+		},
+		{
+			// An indented call ending in ";" is not a prototype
+			name: "c call", file: "a.c", symbol: "helper",
+			src:  "void helper(void) {\n}\n\nint main(void) {\n    helper();\n}\n",
+			want: []LineRange{{Start: 1, End: 2}},
+		},
+		{
+			name: "rust struct with attribute", file: "a.rs", symbol: "Point",
+			src:  "#[derive(Debug)]\nstruct Point {\n    x: i32,\n}\n",
+			want: []LineRange{{Start: 1, End: 4}},
+		},
+		{
+			name: "python decorated function", file: "a.py", symbol: "handler",
+			src:  "@app.route(\"/\")\ndef handler():\n    x = 1\n\n    return x\nprint(1)\n",
+			want: []LineRange{{Start: 1, End: 5}},
+		},
+		{
+			name: "commented out declaration", file: "a.js", symbol: "old",
+			src:  "// function old() {}\n",
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := findSymbolHeuristic(tt.file, []byte(tt.src), tt.symbol)
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("findSymbolHeuristic = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestBraceBlockEnd(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines string
+		want  int
+	}{
+		{"one line", "func a() {}\nnext", 0},
+		{"nested", "a {\n  b {\n  }\n}\nnext", 3},
+		{"brace on next line", "int main()\n{\n}\nnext", 2},
+		{"statement", "const a = 1;\nnext", 0},
+		{"multi-line statement", "const a =\n  1;\nnext", 1},
+		{"string braces", "a {\n  s = \"}\"\n  c = '{'\n}\nnext", 3},
+		{"comment brace", "a {\n  // }\n}\nnext", 2},
+		{"unclosed", "a {\n  b\n", 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := braceBlockEnd(strings.Split(tt.lines, "\n"), 0); got != tt.want {
+				t.Errorf("braceBlockEnd = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIndentedBlockEnd(t *testing.T) {
+	tests := []struct {
+		name  string
+		lines string
+		start int
+		want  int
+	}{
+		{"body", "def a():\n    x\n    y\nz", 0, 2},
+		{"blank lines inside", "def a():\n    x\n\n    y\n\nz", 0, 3},
+		{"nested method", "class A:\n    def b(self):\n        x\n    def c(self):\n        y", 1, 2},
+		{"no body", "x = 1\ny = 2", 0, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := indentedBlockEnd(strings.Split(tt.lines, "\n"), tt.start); got != tt.want {
+				t.Errorf("indentedBlockEnd = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestStripStrings(t *testing.T) {
+	tests := []struct {
+		line string
+		want string
+	}{
+		{`x := "{"`, `x := `},
+		{`s = "a \"}\" b" + t`, `s =  + t`},
+		{`c = '{';`, `c = ;`},
+		{"t = `}` {", "t =  {"},
+		{`f() { // }`, `f() { `},
+		{`url = "http://x" {`, `url =  {`},
+	}
+	for _, tt := range tests {
+		if got := stripStrings(tt.line); got != tt.want {
+			t.Errorf("stripStrings(%q) = %q, want %q", tt.line, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package pkg
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Paths shown for files reached through symbolic links
+const (
+	SymlinkPathLink   = "link"   // The path of the link in the tree
+	SymlinkPathTarget = "target" // The path of the file the link resolves to
+)
+
+// ValidateSymlinkPath checks a --symlink-path value
+func ValidateSymlinkPath(mode string) error {
+	switch mode {
+	case "", SymlinkPathLink, SymlinkPathTarget:
+		return nil
+	}
+	return fmt.Errorf("invalid symlink-path %q: expected %s or %s", mode, SymlinkPathLink, SymlinkPathTarget)
+}
+
+// realPath resolves every symbolic link in path and makes it absolute
+func realPath(path string) (string, error) {
+	real, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return "", err
+	}
+	return filepath.Abs(real)
+}
+
+// inRoot reports whether the real path real is inside the base directory
+func (p *Processor) inRoot(real string) bool {
+	return isWithin(real, p.realRoot)
+}
+
+// isAncestor reports whether the directory dir contains the link at path,
+// so following the link would walk dir again from inside itself
+func (p *Processor) isAncestor(dir, path string) bool {
+	parent, err := realPath(filepath.Dir(path))
+	return err == nil && isWithin(parent, dir)
+}
+
+// displayPath names a real path relative to the base directory, like the
+// paths of the walk, or keeps it absolute when it is outside
+func (p *Processor) displayPath(real string) string {
+	rel, err := filepath.Rel(p.realRoot, real)
+	if err != nil || !isWithin(real, p.realRoot) {
+		return real
+	}
+	return filepath.Join(p.root, rel)
+}
+
+// isWithin reports whether path is dir or inside it; both must be clean
+func isWithin(path, dir string) bool {
+	return path == dir || strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
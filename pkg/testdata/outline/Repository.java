@@ -0,0 +1,49 @@
+package com.example.store;
+
+import java.util.List;
+import java.util.Map;
+
+/**
+ * Stores the items.
+ */
+@Repository
+public class ItemRepository {
+    private static final String QUERY = "SELECT * FROM items WHERE tag = '{'";
+
+    /** Items by id */
+    private final Map<Long, Item> items;
+
+    public ItemRepository(Map<Long, Item> items) {
+        this.items = items;
+    }
+
+    @Override
+    @Transactional(readOnly = true)
+    public List<Item> findAll(
+            int limit,
+            String order) throws StoreException {
+        // } closing brace in a comment
+        String s = "}";
+        return List.copyOf(items.values());
+    }
+
+    public static class Item {
+        public String name;
+
+        public String label() {
+            return "{" + name + "}";
+        }
+    }
+
+    public enum State {
+        OPEN, CLOSED;
+
+        public boolean isOpen() {
+            return this == OPEN;
+        }
+    }
+
+    public interface Listener {
+        void changed(Item item);
+    }
+}
@@ -0,0 +1,52 @@
+#ifndef BUFFER_H
+#define BUFFER_H
+
+#include <stddef.h>
+
+#define BUFFER_OPEN "{"
+
+/* A growable buffer */
+typedef struct buffer {
+    char *data;
+    size_t len;
+    struct {
+        size_t cap;
+        int flags; /* } */
+    } meta;
+} buffer;
+
+enum mode {
+    MODE_READ,
+    MODE_WRITE,
+};
+
+/* Appends text to the buffer */
+int buffer_append(buffer *b,
+                  const char *text,
+                  size_t n);
+
+static inline size_t buffer_len(const buffer *b) {
+    return b ? b->len : 0;
+}
+
+#ifdef __cplusplus
+extern "C" {
+#endif
+
+void buffer_free(buffer *b);
+
+#ifdef __cplusplus
+}
+#endif
+
+namespace store {
+class Buffer {
+public:
+    Buffer(const char *s = "}") {
+        init(s);
+    }
+    size_t size() const;
+};
+}
+
+#endif
@@ -0,0 +1,52 @@
+//! The store library.
+
+use std::collections::HashMap;
+
+pub const LIMIT: usize = 10;
+
+/// An item of the store
+#[derive(Debug, Clone)]
+pub struct Item {
+    pub name: String,
+    price: u32,
+}
+
+impl Item {
+    /// Creates an item
+    pub fn new(name: &str, price: u32) -> Self {
+        let label = format!("{{{}}}", name);
+        Item { name: label, price }
+    }
+
+    pub fn price_with<'a>(
+        &self,
+        rates: &'a HashMap<String, f64>,
+    ) -> f64 {
+        // } in a comment
+        self.price as f64 * rates["vat"]
+    }
+}
+
+pub trait Store {
+    fn get(&self, name: &str) -> Option<&Item>;
+
+    fn count(&self) -> usize {
+        0
+    }
+}
+
+pub mod util {
+    pub fn brace() -> &'static str {
+        "}"
+    }
+}
+
+fn private_helper() {
+    println!("{}", 1);
+}
+
+macro_rules! item {
+    ($name:expr) => {
+        Item::new($name, 0)
+    };
+}
@@ -0,0 +1,47 @@
+"""Models of the shop."""
+
+import json
+from dataclasses import dataclass, field
+
+MAX_ITEMS = 100
+_cache = {}
+
+
+@dataclass
+class Item:
+    """An item of an order."""
+
+    name: str
+    price: float = 0.0
+
+    class Meta:
+        ordering = ["name"]
+
+        def label(self):
+            return "{" + self.name + "}"
+
+    @property
+    def total(self) -> float:
+        # Braces in strings: "}" and '{'
+        return self.price * 1.2
+
+    def _private(self):
+        pass
+
+
+@app.route("/orders/<id>")
+@login_required
+async def get_order(
+    order_id: int,
+    verbose: bool = False,
+) -> dict:
+    """Return an order.
+
+    Raises KeyError when missing.
+    """
+    data = {"id": order_id, "items": []}
+    return json.dumps(data)
+
+
+def _helper():
+    return None
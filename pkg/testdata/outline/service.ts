@@ -0,0 +1,44 @@
+import type { Request } from "./http";
+
+/** Options of the service */
+export interface Options {
+  retries: number;
+  nested: {
+    timeout: number;
+  };
+}
+
+export type Handler = (req: Request) => Promise<void>;
+
+export enum Level {
+  Low = "{",
+  High = "}",
+}
+
+@Injectable()
+export class Service {
+  private cache = new Map<string, string>();
+
+  @Get("/items/{id}")
+  async find(
+    id: string,
+    opts: Options = { retries: 1, nested: { timeout: 5 } },
+  ): Promise<string> {
+    const key = `item:{${id}}`;
+    return this.cache.get(key) ?? "";
+  }
+
+  class = "not a keyword here";
+}
+
+export namespace Util {
+  export function join(a: string, b: string): string {
+    return a + "/" + b;
+  }
+}
+
+export const z = { a: foo(
+  1), b: 2,
+  c: 3 };
+
+export default function main(): void { run(); }
@@ -0,0 +1,68 @@
+// Package shapes computes areas.
+package shapes
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Unit is the unit of the lengths
+const Unit = "cm"
+
+const (
+	// Pi is close enough
+	Pi    = 3.14159
+	scale = 2
+)
+
+var registry = map[string]Shape{}
+
+// Shape is anything with an area
+type Shape interface {
+	Area() float64
+}
+
+// Box has a nested struct
+type Box struct {
+	Size struct {
+		W, H float64 // In Unit
+	}
+	label string
+}
+
+// Area of the box. The braces in the strings and comments of the body
+// don't end it early.
+func (b Box) Area() float64 {
+	s := "}{" // }
+	/* { */
+	_ = strings.Repeat(s, 2) + `}`
+	return b.Size.W * b.Size.H
+}
+
+// Describe formats a shape, with a signature
+// over several lines
+func Describe(
+	s Shape,
+	verbose bool,
+) (string, error) {
+	if verbose {
+		return fmt.Sprintf("%T: %.2f %s", s, s.Area(), Unit), nil
+	}
+	return fmt.Sprint(s.Area()), nil
+}
+
+// Map applies f to each shape
+func Map[T Shape, R any](shapes []T, f func(T) R) []R {
+	var out []R
+	for _, s := range shapes {
+		out = append(out, f(s))
+	}
+	return out
+}
+
+func helper() {}
+
+type circle struct{ r float64 }
+
+// Area is a method of an unexported type, left out
+func (c circle) Area() float64 { return Pi * c.r * c.r }
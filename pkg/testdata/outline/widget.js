@@ -0,0 +1,41 @@
+// Widgets of the dashboard
+import { render } from "./render.js";
+
+const TEMPLATE = "<div>{title}</div>";
+
+/**
+ * A widget draws itself.
+ */
+export class Widget {
+  constructor(title) {
+    this.title = title;
+  }
+
+  // Braces in strings and comments: "}" '{' // }
+  draw() {
+    return render(TEMPLATE.replace("{title}", this.title));
+  }
+
+  static create(
+    title,
+    options = { size: 1 },
+  ) {
+    return new Widget(title);
+  }
+}
+
+function internal() {
+  return "{";
+}
+
+export const handlers = {
+  click: () => {
+    console.log("}");
+  },
+};
+
+module.exports = { Widget };
+
+export function parse(text) { // text like "{a}" or {b
+  return JSON.parse(text);
+}